@@ -4,11 +4,12 @@ package barlib
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"sync"
@@ -44,30 +45,111 @@ type Instance interface {
 	// 25ms). The provided duration is not exact must be a multiple of the bar's
 	// base tick rate. If zero, the ticker does not tick. The returned channel
 	// has a buffer size of 1 (i.e., missed ticks will trigger as soon as
-	// possible, but only one missed tick at a time).
+	// possible, but only one missed tick at a time). While the instance is
+	// stopped, ticks are suspended, and if any were missed, a single tick is
+	// sent when it is continued.
 	Tick(interval time.Duration) <-chan uint64
 
 	// TickReset updates the interval for a divided ticker channel.
 	TickReset(s <-chan uint64, interval time.Duration)
 
+	// TickAligned returns a ticker channel which fires on wall-clock
+	// boundaries (see [Aligned]), e.g., at the start of every second or
+	// minute. Like Tick, it is suspended while the instance is stopped, has a
+	// buffer size of 1, and does not tick if the interval is zero. It is
+	// stopped when the instance context is cancelled.
+	TickAligned(interval time.Duration) <-chan time.Time
+
+	// At returns a channel which receives a single tick at the specified time
+	// (or as soon as possible if it is in the past). Like TickAligned, it is
+	// delayed while the instance is stopped.
+	At(t time.Time) <-chan time.Time
+
+	// Schedule is like TickAligned, but for an arbitrary schedule (e.g., from
+	// [ParseCron]).
+	Schedule(s Schedule) <-chan time.Time
+
 	// Update builds and submits an update for the bar. The renderer must only
 	// be used within the function. If now is true, the new bar will be drawn
 	// immediately instead of attempting to coalesce draws. The Block.Name field
 	// is used internally and will be overridden.
 	Update(now bool, fn func(render Renderer))
 
+	// Attach attaches handlers to the blocks with the specified instance in
+	// the update being built, replacing the ones from the previous update. It
+	// must only be called from the function passed to Update.
+	Attach(instance string, handlers ...Handler)
+
 	// IsStopped checks whether the bar is currently stopped. This is just a
 	// hint, and doesn't need to be followed.
 	IsStopped() bool
 
-	// Event gets the event channel. Up to 16 events are buffered.
+	// Event gets the event channel. Events routed to handlers attached to
+	// blocks are not sent here (see Attach). Up to 16 events are buffered.
 	Event() <-chan barproto.Event
 
+	// Handle gets the channel for events routed to handlers attached to blocks
+	// in the most recent update (see Attach). The received functions call the
+	// handler, and must be called from the module. Up to 16 calls are
+	// buffered.
+	Handle() <-chan func()
+
 	// Stopped gets a channel which notifies when IsStopped changes. The buffer
 	// size is 1 since the actual value is read from IsStopped.
 	Stopped() <-chan struct{}
 
-	// Debug writes debug logs.
+	// Resumed gets a channel which notifies after the system resumes from
+	// sleep or the wall clock jumps, which can be used to reset baselines for
+	// time-based calculations. All tickers also receive an immediate tick
+	// after this is notified. The buffer size is 1.
+	Resumed() <-chan struct{}
+
+	// Context returns a context which is cancelled when the instance is torn
+	// down after Run returns, or when the bar is shut down. Each run of the
+	// module gets its own instance with a new context. It should be used
+	// for cleaning up goroutines and connections, and for cancelling external
+	// commands and requests.
+	Context() context.Context
+
+	// Signal returns a channel which is notified when the process receives
+	// SIGRTMIN+n (e.g., from "pkill -RTMIN+n"), like i3blocks, where SIGRTMIN
+	// is glibc's (34). It is unsubscribed when the instance context is
+	// cancelled. The value of n must be between 0 and 30. The buffer size is
+	// 1.
+	Signal(n int) <-chan struct{}
+
+	// Action gets the channel for named actions triggered externally via the
+	// control socket. The meaning of action names is defined by the module.
+	// Up to 16 actions are buffered.
+	Action() <-chan string
+
+	// Logger returns a logger with attributes identifying the instance.
+	Logger() *slog.Logger
+
+	// State returns the key/value store for the instance, which is kept when
+	// the module is restarted or the bar is hot-restarted. It is matched to
+	// the instance by the module type and position.
+	State() *State
+
+	// Theme returns the theme to use for colors and spacing, adjusted for the
+	// current capabilities (see [Theme.For]).
+	Theme() Theme
+
+	// Capabilities returns the optional protocol features supported by the
+	// bar, or by all bars showing the instance when running as a daemon. It
+	// may change when bars are attached or detached, so it should be checked
+	// while rendering.
+	Capabilities() barproto.Capabilities
+
+	// CapabilitiesChanged gets a channel which notifies when Capabilities
+	// changes, which should be used to re-render blocks depending on it. The
+	// buffer size is 1 since the actual value is read from Capabilities.
+	CapabilitiesChanged() <-chan struct{}
+
+	// Debug writes debug logs. For compatibility, they are logged at the info
+	// level so they are shown by default.
+	//
+	// Deprecated: Use Logger instead.
 	Debug(format string, a ...any)
 }
 
@@ -75,100 +157,216 @@ type Instance interface {
 // common block layouts.
 type Renderer func(barproto.Block)
 
-// Err renders an error message block.
+// Err renders an error message block styled using [I3Theme]. To use the
+// instance's theme, use [Theme.Err] instead.
 func (r Renderer) Err(err error) {
-	var s string
-	if err != nil {
-		s = err.Error()
-	} else {
-		s = "<nil>"
-	}
-	r(barproto.Block{
-		FullText:     " error: " + s + " ",
-		ShortText:    "ERR",
-		Urgent:       true,
-		Separator:    true,
-		Background:   0xFF0000FF,
-		BorderTop:    -1,
-		BorderLeft:   -1,
-		BorderBottom: -1,
-		BorderRight:  -1,
-	})
+	I3Theme.Err(r, err)
 }
 
-type instanceImpl struct {
-	name       string
-	invalidate func(now bool)
+// bar contains state shared between instances.
+type bar struct {
 	ticker     *tickDivider
+	signals    *signalNotifier
+	logger     *slog.Logger
+	invalidate func(now bool)
+	instances  []*instanceImpl
+	state      *stateStore
+	theme      Theme
+
+	viewersMu sync.Mutex
+	viewers   map[*viewer]struct{}
+}
+
+type instanceImpl struct {
+	bar    *bar
+	name   string
+	typ    string
+	logger *slog.Logger
+	state  *State
 
 	// notify
 	eventCh   chan barproto.Event
+	handleCh  chan func()
+	actionCh  chan string
 	stoppedCh chan struct{}
-	tickersCh chan struct{}
+	resumedCh chan struct{}
+	capsCh    chan struct{}
+
+	// capabilities and theme as of the last notification (guarded by
+	// bar.viewersMu)
+	caps  barproto.Capabilities
+	theme Theme
 
 	// stopped state
 	stopped atomic.Bool
 
+	// whether events are read directly for the current run (or to restart
+	// it), in which case all buttons are handled
+	events atomic.Bool
+
+	// closed when the stopped state changes or the clock jumps
+	wakeMu sync.Mutex
+	wakeCh chan struct{}
+
 	// last renderer output
 	buf1m sync.Mutex
-	buf1b []byte
+	buf1b []barproto.Block
+	buf1h Handlers
 
 	// renderer output
 	buf2m sync.Mutex
-	buf2b []byte
+	buf2b []barproto.Block
+	buf2h Handlers
+	buf2u bool // Update is in progress
+}
+
+// moduleType gets the type name of m, unwrapping [WithRestart].
+func moduleType(m Module) string {
+	if r, ok := m.(restartModule); ok {
+		m = r.Module
+	}
+	return fmt.Sprintf("%T", m)
 }
 
-func instantiate(m Module, name string, ticker *tickDivider, invalidate func(now bool)) *instanceImpl {
+func instantiate(ctx context.Context, b *bar, m Module, name string, restart RestartPolicy) *instanceImpl {
+	if r, ok := m.(restartModule); ok {
+		restart = r.policy
+		m = r.Module
+	}
 	instance := &instanceImpl{
-		name:       name,
-		invalidate: invalidate,
-		ticker:     ticker,
-		eventCh:    make(chan barproto.Event, 16),
-		stoppedCh:  make(chan struct{}, 1),
-		tickersCh:  make(chan struct{}),
+		bar:       b,
+		name:      name,
+		typ:       moduleType(m),
+		eventCh:   make(chan barproto.Event, 16),
+		handleCh:  make(chan func(), 16),
+		actionCh:  make(chan string, 16),
+		stoppedCh: make(chan struct{}, 1),
+		resumedCh: make(chan struct{}, 1),
+		capsCh:    make(chan struct{}, 1),
 	}
+	instance.logger = b.logger.With("module", instance.name, "type", instance.typ)
+	instance.state = b.state.State(instance.name, instance.typ)
 	go func() {
-		for {
+		for attempt := 0; ; {
+			started := time.Now()
 			err := func() (err error) {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel() // also stops the tickers
+
 				defer func() {
 					if p := recover(); p != nil {
 						err = fmt.Errorf("panic: %v", p)
 					}
 				}()
-				return m.Run(instance)
+
+				instance.events.Store(false)
+				return m.Run(&instanceRun{instance, ctx})
 			}()
-			if err == nil {
+			if err == nil || ctx.Err() != nil {
 				break
 			}
-			// stop the tickers
-			close(instance.tickersCh)
-			instance.tickersCh = make(chan struct{})
 			// drain events
 			for {
 				select {
 				case <-instance.eventCh:
 					continue
+				case <-instance.handleCh:
+					continue
+				case <-instance.actionCh:
+					continue
 				default:
 				}
 				break
 			}
-			// show the error
-			instance.Update(true, func(r Renderer) {
-				r.Err(fmt.Errorf("fatal: %w", err))
-			})
-			// wait for a click before recreating the instance
-			<-instance.eventCh
+			// reset the backoff if it isn't a consecutive failure
+			if time.Since(started) > restart.maxBackoff() {
+				attempt = 0
+			}
+			// wait for a click or the automatic restart before recreating the
+			// instance, showing the error and countdown
+			instance.events.Store(true)
+			var retry time.Time
+			if d, ok := restart.delay(attempt); ok {
+				instance.logger.Warn("module failed, restarting automatically", "error", err, "attempt", attempt+1, "delay", d)
+				retry = time.Now().Add(d)
+				attempt++
+			} else {
+				instance.logger.Warn("module failed, waiting for click to restart", "error", err)
+			}
+			for {
+				remaining := time.Until(retry)
+				if !retry.IsZero() && remaining <= 0 {
+					break
+				}
+				instance.Update(true, func(r Renderer) {
+					switch {
+					case restart.Hide:
+					case retry.IsZero():
+						instance.Theme().Err(r, fmt.Errorf("fatal: %w", err))
+					default:
+						instance.Theme().Err(r, fmt.Errorf("fatal: %w (restarting in %s)", err, (remaining+time.Second-1).Truncate(time.Second)))
+					}
+				})
+				var timer <-chan time.Time
+				if !retry.IsZero() {
+					timer = time.After(remaining - (remaining - 1).Truncate(time.Second))
+				}
+				select {
+				case <-instance.eventCh:
+					instance.logger.Info("restarting module after click")
+					attempt = 0
+				case <-timer:
+					continue
+				case <-instance.capsCh:
+					continue
+				case <-ctx.Done():
+					return
+				}
+				break
+			}
 		}
 	}()
 	return instance
 }
 
-func (i *instanceImpl) Tick(interval time.Duration) <-chan uint64 {
-	return i.ticker.Tick(i.tickersCh, interval)
+// instanceRun is the [Instance] passed to a single run of a module. Since the
+// context is different for each run, goroutines left over from a previous run
+// keep seeing their own cancelled context instead of the new one.
+type instanceRun struct {
+	*instanceImpl
+	ctx context.Context
+}
+
+func (i *instanceRun) Tick(interval time.Duration) <-chan uint64 {
+	return i.bar.ticker.Tick(i.ctx.Done(), i.instanceImpl, interval)
 }
 
 func (i *instanceImpl) TickReset(s <-chan uint64, interval time.Duration) {
-	i.ticker.Reset(s, interval)
+	i.bar.ticker.Reset(s, interval)
+}
+
+func (i *instanceRun) TickAligned(interval time.Duration) <-chan time.Time {
+	return i.Schedule(Aligned(interval))
+}
+
+func (i *instanceRun) At(t time.Time) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	go i.schedule(i.ctx, ch, t, nil)
+	return ch
+}
+
+func (i *instanceRun) Schedule(s Schedule) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	go i.schedule(i.ctx, ch, s.Next(time.Now()), s)
+	return ch
+}
+
+func (i *instanceRun) Context() context.Context {
+	return i.ctx
+}
+
+func (i *instanceRun) Signal(n int) <-chan struct{} {
+	return i.bar.signals.Notify(i.ctx.Done(), rtSignal(n))
 }
 
 func (i *instanceImpl) Update(now bool, fn func(Renderer)) {
@@ -176,19 +374,30 @@ func (i *instanceImpl) Update(now bool, fn func(Renderer)) {
 	defer i.buf2m.Unlock()
 
 	i.buf2b = i.buf2b[:0]
-	fn(Renderer(func(b barproto.Block) {
+	i.buf2h.Reset()
+	i.buf2u = true
+	fn(func(b barproto.Block) {
 		b.Name = i.name
-		i.buf2b = b.AppendJSON(append(i.buf2b, ','))
-	}))
+		i.buf2b = append(i.buf2b, b)
+	})
+	i.buf2u = false
 
 	i.buf1m.Lock()
 	defer i.buf1m.Unlock()
 
 	i.buf1b, i.buf2b = i.buf2b, i.buf1b
+	i.buf1h, i.buf2h = i.buf2h, i.buf1h
+
+	if !slices.Equal(i.buf1b, i.buf2b) {
+		i.bar.invalidate(now)
+	}
+}
 
-	if !bytes.Equal(i.buf1b, i.buf2b) {
-		i.invalidate(now)
+func (i *instanceImpl) Attach(instance string, handlers ...Handler) {
+	if !i.buf2u {
+		panic("barlib: Attach called outside of Update")
 	}
+	i.buf2h.Add(instance, handlers...)
 }
 
 func (i *instanceImpl) IsStopped() bool {
@@ -196,19 +405,74 @@ func (i *instanceImpl) IsStopped() bool {
 }
 
 func (i *instanceImpl) Event() <-chan barproto.Event {
+	i.events.Store(true)
 	return i.eventCh
 }
 
+// buttons returns a bitmask of the buttons handled for the block instance.
+func (i *instanceImpl) buttons(instance string) uint32 {
+	if i.events.Load() {
+		return ^uint32(0)
+	}
+	i.buf1m.Lock()
+	defer i.buf1m.Unlock()
+	return i.buf1h.buttons(instance)
+}
+
+func (i *instanceImpl) Handle() <-chan func() {
+	return i.handleCh
+}
+
 func (i *instanceImpl) Stopped() <-chan struct{} {
 	return i.stoppedCh
 }
 
+func (i *instanceImpl) Resumed() <-chan struct{} {
+	return i.resumedCh
+}
+
+func (i *instanceImpl) Action() <-chan string {
+	return i.actionCh
+}
+
+func (i *instanceImpl) Logger() *slog.Logger {
+	return i.logger
+}
+
+func (i *instanceImpl) State() *State {
+	return i.state
+}
+
+func (i *instanceImpl) Theme() Theme {
+	i.bar.viewersMu.Lock()
+	defer i.bar.viewersMu.Unlock()
+	return i.bar.themeLocked(i)
+}
+
+func (i *instanceImpl) Capabilities() barproto.Capabilities {
+	return i.bar.capabilities(i)
+}
+
+func (i *instanceImpl) CapabilitiesChanged() <-chan struct{} {
+	return i.capsCh
+}
+
 func (i *instanceImpl) Debug(format string, a ...any) {
-	fmt.Fprintln(os.Stderr, "debug: "+i.name+": "+fmt.Sprintf(format, a...))
+	i.logger.Info(fmt.Sprintf(format, a...))
 }
 
 func (i *instanceImpl) SendEvent(event barproto.Event) {
 	if event.Name == i.name {
+		i.buf1m.Lock()
+		fn, ok := i.buf1h.Route(event)
+		i.buf1m.Unlock()
+		if ok {
+			select {
+			case i.handleCh <- fn:
+			default:
+			}
+			return
+		}
 		select {
 		case i.eventCh <- event:
 		default:
@@ -216,96 +480,226 @@ func (i *instanceImpl) SendEvent(event barproto.Event) {
 	}
 }
 
+func (i *instanceImpl) SendAction(action string) bool {
+	select {
+	case i.actionCh <- action:
+		return true
+	default:
+		return false
+	}
+}
+
 func (i *instanceImpl) SendStopped(stopped bool) {
+	i.bar.ticker.SetStopped(i, stopped)
 	i.stopped.Store(stopped)
+	i.wake()
 	select {
 	case i.stoppedCh <- struct{}{}:
 	default:
 	}
 }
 
-func (i *instanceImpl) WriteTo(w io.Writer, comma bool) bool {
-	i.buf1m.Lock()
-	defer i.buf1m.Unlock()
+func (i *instanceImpl) SendCapabilitiesChanged() {
+	select {
+	case i.capsCh <- struct{}{}:
+	default:
+	}
+}
 
-	if len(i.buf1b) <= 1 {
-		return comma
+func (i *instanceImpl) SendResumed() {
+	i.wake()
+	select {
+	case i.resumedCh <- struct{}{}:
+	default:
 	}
+}
 
-	var err error
-	if comma {
-		_, err = w.Write(i.buf1b)
-	} else {
-		_, err = w.Write(i.buf1b[1:])
+// waker returns a channel which is closed on the next call to wake.
+func (i *instanceImpl) waker() <-chan struct{} {
+	i.wakeMu.Lock()
+	defer i.wakeMu.Unlock()
+	if i.wakeCh == nil {
+		i.wakeCh = make(chan struct{})
 	}
-	if err != nil {
-		panic(err)
+	return i.wakeCh
+}
+
+func (i *instanceImpl) wake() {
+	i.wakeMu.Lock()
+	defer i.wakeMu.Unlock()
+	if i.wakeCh != nil {
+		close(i.wakeCh)
+		i.wakeCh = nil
 	}
-	return true
+}
+
+func (i *instanceImpl) AppendTo(b []barproto.Block) []barproto.Block {
+	i.buf1m.Lock()
+	defer i.buf1m.Unlock()
+
+	return append(b, i.buf1b...)
 }
 
 const tickDividerStrict = true
 
 type tickDivider struct {
 	b time.Duration                   // base interval
+	t time.Time                       // start time
+	o time.Duration                   // last offset between the wall and monotonic clocks
+	f func()                          // called after a suspend or clock jump
 	c chan struct{}                   // cancel channel
-	s map[chan<- uint64]uint64        // map of sub-tickers to multiple of base interval
+	w chan struct{}                   // wake channel
+	j chan struct{}                   // resume channel
+	s map[chan<- uint64]tickSub       // map of sub-tickers to their state
 	r map[<-chan uint64]chan<- uint64 // map of sub-tickers to themselves
-	m sync.Mutex                      // lock for sub-ticker map
+	p map[any]uint64                  // map of stopped groups to the tick they were stopped at
+	m sync.Mutex                      // lock for sub-ticker and group maps
 }
 
-func newTickDivider(base time.Duration) *tickDivider {
+type tickSub struct {
+	i uint64 // multiple of base interval
+	g any    // group
+}
+
+// tickDividerJump is the minimum change in the offset between the wall and
+// monotonic clocks which is considered to be a suspend or clock jump (the
+// monotonic clock doesn't advance while suspended).
+const tickDividerJump = time.Second * 2
+
+func newTickDivider(base time.Duration, resumed func()) *tickDivider {
 	c := make(chan struct{})
 	d := &tickDivider{
 		b: base,
+		t: time.Now(),
+		f: resumed,
 		c: c,
-		s: make(map[chan<- uint64]uint64),
+		w: make(chan struct{}, 1),
+		j: make(chan struct{}, 1),
+		s: make(map[chan<- uint64]tickSub),
 		r: make(map[<-chan uint64]chan<- uint64),
+		p: make(map[any]uint64),
 	}
 	go func() {
-		t := time.NewTicker(base)
-		defer t.Stop()
-		var n uint64
 		for {
-			select {
-			case <-t.C:
-				d.m.Lock()
-				for s, i := range d.s {
-					if i != 0 && n%i == 0 {
-						select {
-						case s <- n:
-						default:
-							// tick missed
-						}
-					}
+			// sleep until something needs ticks or the system resumes
+			d.m.Lock()
+			active := d.active()
+			d.m.Unlock()
+
+			// otherwise, wait for the next tick, keeping ticks aligned to the
+			// start time
+			var resumed bool
+			n := d.n()
+			if !active {
+				select {
+				case <-d.w:
+					continue
+				case <-d.j:
+					resumed = true
+				case <-c:
+					d.stop()
+					return
 				}
-				d.m.Unlock()
-				n++
-			case <-c:
-				d.m.Lock()
-				for s1, s2 := range d.r {
-					delete(d.r, s1)
-					delete(d.s, s2)
+			} else {
+				t := time.NewTimer(time.Until(d.t.Add(time.Duration(n+1) * d.b)))
+				select {
+				case <-t.C:
+				case <-d.j:
+					t.Stop()
+					resumed = true
+				case <-c:
+					t.Stop()
+					d.stop()
+					return
 				}
-				d.s = nil
-				d.m.Unlock()
-				return
 			}
+
+			// force a tick for all sub-tickers after a resume, after notifying
+			// about it so baselines can be reset before the tick
+			jumped := d.jumped() || resumed
+			if jumped && d.f != nil {
+				d.f()
+			}
+
+			d.m.Lock()
+			for s, x := range d.s {
+				if _, stopped := d.p[x.g]; !stopped && x.i != 0 && (jumped || n%x.i == 0) {
+					select {
+					case s <- n:
+					default:
+						// tick missed
+					}
+				}
+			}
+			d.m.Unlock()
 		}
 	}()
 	return d
 }
 
+// n gets the number of ticks since the start, which is also the current tick.
+func (d *tickDivider) n() uint64 {
+	return uint64(time.Since(d.t) / d.b)
+}
+
+// jumped checks whether the system was suspended or the wall clock jumped since
+// the last call.
+func (d *tickDivider) jumped() bool {
+	now := time.Now()
+	o := now.Round(0).Sub(d.t.Round(0)) - now.Sub(d.t)
+	j := o-d.o > tickDividerJump || d.o-o > tickDividerJump
+	d.o = o
+	return j
+}
+
+// active checks if any sub-tickers need ticks. The lock must be held.
+func (d *tickDivider) active() bool {
+	for _, x := range d.s {
+		if _, stopped := d.p[x.g]; !stopped && x.i != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wake wakes the ticker if it is sleeping.
+func (d *tickDivider) wake() {
+	select {
+	case d.w <- struct{}{}:
+	default:
+	}
+}
+
+func (d *tickDivider) stop() {
+	d.m.Lock()
+	for s1, s2 := range d.r {
+		delete(d.r, s1)
+		delete(d.s, s2)
+	}
+	d.s = nil
+	d.m.Unlock()
+}
+
+// Resume forces a tick for all sub-tickers and calls the resume callback, for
+// resumes detected externally. Jumps are only detected while ticking.
+func (d *tickDivider) Resume() {
+	select {
+	case d.j <- struct{}{}:
+	default:
+	}
+}
+
 func (d *tickDivider) Base() time.Duration {
 	return d.b
 }
 
-func (d *tickDivider) Tick(cancel <-chan struct{}, interval time.Duration) <-chan uint64 {
+// Tick creates a sub-ticker in group until cancel is closed.
+func (d *tickDivider) Tick(cancel <-chan struct{}, group any, interval time.Duration) <-chan uint64 {
 	n := d.interval(interval)
 	s := make(chan uint64, 1)
 	d.m.Lock()
 	if d.s != nil {
-		d.s[s] = n
+		d.s[s] = tickSub{n, group}
 		d.r[s] = s
 		if cancel != nil {
 			go func() {
@@ -316,6 +710,7 @@ func (d *tickDivider) Tick(cancel <-chan struct{}, interval time.Duration) <-cha
 				d.m.Unlock()
 			}()
 		}
+		d.wake()
 	}
 	d.m.Unlock()
 	return s
@@ -326,12 +721,43 @@ func (d *tickDivider) Reset(s <-chan uint64, interval time.Duration) {
 	d.m.Lock()
 	if d.s != nil {
 		if s, ok := d.r[s]; ok {
-			d.s[s] = n
+			d.s[s] = tickSub{n, d.s[s].g}
+			d.wake()
 		}
 	}
 	d.m.Unlock()
 }
 
+// SetStopped suspends or resumes the sub-tickers in group. When resuming,
+// sub-tickers which missed ticks while suspended get a single tick.
+func (d *tickDivider) SetStopped(group any, stopped bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.s == nil {
+		return
+	}
+	start, wasStopped := d.p[group]
+	if stopped == wasStopped {
+		return
+	}
+	if stopped {
+		d.p[group] = d.n()
+		return
+	}
+	delete(d.p, group)
+	for s, x := range d.s {
+		if x.g == group && x.i != 0 {
+			if n := d.n(); (start+x.i-1)/x.i*x.i < n {
+				select {
+				case s <- (n - 1) / x.i * x.i:
+				default:
+				}
+			}
+		}
+	}
+	d.wake()
+}
+
 func (d *tickDivider) interval(interval time.Duration) uint64 {
 	if interval < 0 {
 		panic(fmt.Errorf("tick interval %s is negative", interval))
@@ -348,123 +774,351 @@ func (d *tickDivider) Stop() {
 	close(d.c)
 }
 
-// Main runs the status bar with the provided modules.
+// DefaultUpdateDelay is the default amount of time to wait after an update
+// before drawing the bar.
+const DefaultUpdateDelay = time.Millisecond * 25
+
+// Options configures the bar for [Run].
+type Options struct {
+	// Stdin is where click events are read from. If nil, click events are
+	// not enabled. When it returns EOF, the bar exits.
+	Stdin io.Reader
+
+	// Stdout is where the status line is written to. If nil, the bar runs as
+	// a daemon, and bars are attached over the control socket (see [Attach]).
+	Stdout io.Writer
+
+	// TickRate is the base tick rate for aligned ticks. It must be positive.
+	TickRate time.Duration
+
+	// UpdateDelay is the amount of time to wait after an update before drawing
+	// the bar, to coalesce updates from multiple modules. If zero,
+	// DefaultUpdateDelay is used.
+	UpdateDelay time.Duration
+
+	// StopSignal and ContSignal are the signals which the bar will send when it
+	// is hidden or shown. If non-zero, they will be handled and passed to the
+	// bar in the header.
+	StopSignal syscall.Signal
+	ContSignal syscall.Signal
+
+	// Restart is the default restart policy for modules. It can be
+	// overridden for individual modules using [WithRestart].
+	Restart RestartPolicy
+
+	// Logger is used for logs from barlib and modules. If nil,
+	// [slog.Default] is used.
+	Logger *slog.Logger
+
+	// ControlSocket is the path to a unix socket to listen on for external
+	// control (see [DefaultControlSocket] and the barlibctl command). If
+	// empty, the control socket is disabled. If Stdout is set and the socket
+	// can't be created, a warning is logged and the bar runs without it.
+	ControlSocket string
+
+	// Output is the status bar protocol to write. If nil, [I3barOutput] is
+	// used.
+	Output Output
+
+	// Select, if not empty, only runs the modules matching one of the
+	// specified targets, which are instance names or module type names like
+	// for the control socket. Instance names are still based on the index in
+	// the full list of modules.
+	Select []string
+
+	// WatchBinary re-executes the current process when its binary is rebuilt.
+	// The header is not written again after restarting, and the instance
+	// state is restored.
+	WatchBinary bool
+
+	// StateFile is the path to persist the instance state to (see
+	// [DefaultStateFile]). If empty, the state is not persisted. It must not be
+	// shared with other bars running at the same time.
+	StateFile string
+
+	// Theme is the theme used by modules and for errors shown by the bar. If
+	// nil, [I3Theme] is used.
+	Theme *Theme
+
+	// Bar is the bar Stdout is connected to, which determines the
+	// capabilities available to modules. If empty, it is detected using
+	// [barproto.DetectBar]. If the bar is unknown, the theme is not adjusted
+	// using [Theme.For].
+	Bar barproto.Bar
+}
+
+// Main runs the status bar with the provided modules on stdin/stdout, exiting
+// when stdin is closed. Logs are written to [slog.Default].
 //
 // Do not use the Block/Event Name field from the modules; this is used
 // internally to differentiate between instantiated modules for events. Use the
 // Event Instance field for handling click events on different blocks
 // differently.
 func Main(tickRate time.Duration, modules ...Module) {
+	if err := Run(context.Background(), Options{
+		Stdin:         os.Stdin,
+		Stdout:        os.Stdout,
+		TickRate:      tickRate,
+		StopSignal:    syscall.SIGUSR1,
+		ContSignal:    syscall.SIGUSR2,
+		ControlSocket: DefaultControlSocket(),
+		WatchBinary:   true,
+	}, modules...); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Run runs the status bar with the provided modules until ctx is cancelled or
+// stdin is closed, in which case it returns nil.
+//
+// See [Main] for more information.
+func Run(ctx context.Context, opt Options, modules ...Module) error {
 	const (
-		restartEnv  = "BARLIB_RESTARTED=1"
-		stopSignal  = syscall.SIGUSR1
-		contSignal  = syscall.SIGUSR2
-		updateDelay = time.Millisecond * 25
+		restartEnv = "BARLIB_RESTARTED=1"
+		stateEnv   = "BARLIB_STATE"
 	)
+	if opt.Stdout == nil && opt.ControlSocket == "" {
+		return fmt.Errorf("no stdout or control socket provided")
+	}
+	if opt.TickRate <= 0 {
+		return fmt.Errorf("tick rate %s is not positive", opt.TickRate)
+	}
+	if opt.UpdateDelay == 0 {
+		opt.UpdateDelay = DefaultUpdateDelay
+	}
+	if opt.Logger == nil {
+		opt.Logger = slog.Default()
+	}
+	if opt.Output == nil {
+		opt.Output = I3barOutput{}
+	}
+	if opt.Theme == nil {
+		opt.Theme = &I3Theme
+	}
+	if opt.Bar == barproto.UnknownBar && opt.Stdout != nil {
+		opt.Bar = barproto.DetectBar()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 	var (
-		ticker          = newTickDivider(tickRate)
 		delayer         *time.Timer
-		instances       = make([]*instanceImpl, len(modules))
+		instances       = make([]*instanceImpl, 0, len(modules))
 		invalidateCh    = make(chan struct{}, 1)
 		invalidateNowCh = make(chan struct{}, 1)
-	)
-	go func() {
-		exe, err := os.Executable()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "watcher: failed to watch own binary: get own path: %v", err)
-			return
+		stateChangedCh  = make(chan struct{}, 1)
+		b               = &bar{
+			signals: newSignalNotifier(),
+			logger:  opt.Logger,
+			theme:   *opt.Theme,
+			viewers: make(map[*viewer]struct{}),
+			state: newStateStore(func() {
+				select {
+				case stateChangedCh <- struct{}{}:
+				default:
+				}
+			}),
 		}
-
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "watcher: failed to watch own binary: create watcher: %v", err)
-			return
+	)
+	b.ticker = newTickDivider(opt.TickRate, func() {
+		opt.Logger.Info("detected resume or clock jump, refreshing modules")
+		for _, instance := range b.instances {
+			instance.SendResumed()
 		}
-		defer watcher.Close()
-
-		if err := watcher.Add(exe); err != nil {
-			fmt.Fprintf(os.Stderr, "watcher: failed to watch own binary: update watcher: %v", err)
-			return
+	})
+	defer b.ticker.Stop()
+	defer b.signals.Stop()
+	go watchResume(ctx, opt.Logger, b.ticker.Resume)
+	if opt.StateFile != "" {
+		if err := b.state.Load(opt.StateFile); err != nil {
+			opt.Logger.Warn("failed to load state", "path", opt.StateFile, "error", err)
 		}
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if ok && event.Has(fsnotify.Chmod) {
-					// go build chmods it at the end of the build
-					fmt.Fprintf(os.Stderr, "watcher: got chmod, restarting in 500ms\n")
-					time.Sleep(time.Millisecond * 500)
-					if err := syscall.Exec(exe, os.Args, append(os.Environ(), restartEnv)); err != nil {
-						fmt.Fprintf(os.Stderr, "watcher: restart failed: %v\n", err)
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if ok {
-					fmt.Fprintf(os.Stderr, "watcher: warning: %v", err)
-				}
+		defer func() {
+			if err := b.state.Save(opt.StateFile); err != nil {
+				opt.Logger.Warn("failed to save state", "path", opt.StateFile, "error", err)
 			}
-		}
-	}()
-	for i, module := range modules {
-		instances[i] = instantiate(module, strconv.Itoa(i), ticker, func(now bool) {
-			if now {
+		}()
+		go func() {
+			for {
 				select {
-				case invalidateNowCh <- struct{}{}:
-				default:
+				case <-stateChangedCh:
+				case <-ctx.Done():
+					return
 				}
-			} else {
 				select {
-				case invalidateCh <- struct{}{}:
-				default:
+				case <-time.After(time.Second): // coalesce changes
+				case <-ctx.Done():
+					return // saved on exit
+				}
+				if err := b.state.Save(opt.StateFile); err != nil {
+					opt.Logger.Warn("failed to save state", "path", opt.StateFile, "error", err)
 				}
 			}
-		})
+		}()
 	}
-	go func() {
-		sc := bufio.NewScanner(os.Stdin)
-		for sc.Scan() {
-			buf := sc.Bytes()
-			if len(buf) == 0 {
-				continue
+	if path := os.Getenv(stateEnv); opt.WatchBinary && path != "" {
+		if err := b.state.Load(path); err != nil {
+			opt.Logger.Warn("failed to restore state after restart", "path", path, "error", err)
+		}
+		os.Remove(path)
+		os.Unsetenv(stateEnv)
+	}
+	if opt.WatchBinary {
+		go func() {
+			logger := opt.Logger.With("component", "watcher")
+
+			exe, err := os.Executable()
+			if err != nil {
+				logger.Error("failed to watch own binary: get own path", "error", err)
+				return
 			}
-			if buf[0] == '[' || buf[0] == ',' {
-				buf = buf[1:]
+
+			watcher, err := fsnotify.NewWatcher()
+			if err != nil {
+				logger.Error("failed to watch own binary: create watcher", "error", err)
+				return
 			}
-			if len(buf) == 0 || buf[0] != '{' || buf[len(buf)-1] != '}' {
-				if sc.Text() != "[" {
-					fmt.Fprintf(os.Stderr, "warning: invalid event line %q", sc.Text())
+			defer watcher.Close()
+
+			if err := watcher.Add(exe); err != nil {
+				logger.Error("failed to watch own binary: update watcher", "error", err)
+				return
+			}
+			for {
+				select {
+				case event, ok := <-watcher.Events:
+					if ok && event.Has(fsnotify.Chmod) {
+						// go build chmods it at the end of the build
+						logger.Info("got chmod, restarting in 500ms", "exe", exe)
+						time.Sleep(time.Millisecond * 500)
+						env := append(os.Environ(), restartEnv)
+						path := filepath.Join(controlSocketDir(), "barlib."+strconv.Itoa(os.Getpid())+".state.json")
+						if err := b.state.Save(path); err != nil {
+							logger.Warn("failed to save state for restart", "error", err)
+						} else {
+							env = append(env, stateEnv+"="+path)
+						}
+						if err := syscall.Exec(exe, os.Args, env); err != nil {
+							logger.Error("restart failed", "error", err)
+						}
+					}
+				case err, ok := <-watcher.Errors:
+					if ok {
+						logger.Warn("watcher error", "error", err)
+					}
+				case <-ctx.Done():
+					return
 				}
-				continue
 			}
-			var event barproto.Event
-			event.FromJSON(buf)
-			for _, instance := range instances {
-				instance.SendEvent(event)
+		}()
+	}
+	b.invalidate = func(now bool) {
+		if now {
+			select {
+			case invalidateNowCh <- struct{}{}:
+			default:
+			}
+		} else {
+			select {
+			case invalidateCh <- struct{}{}:
+			default:
 			}
 		}
-		panic(fmt.Errorf("stdin failed (error: %w)", sc.Err()))
-	}()
-	go func() {
-		sigCh := make(chan os.Signal, 2)
-		signal.Notify(sigCh, stopSignal, contSignal)
-		for sig := range sigCh {
-			switch sig {
-			case stopSignal:
-				for _, instance := range instances {
-					instance.SendStopped(true)
+	}
+	for i, module := range modules {
+		name := strconv.Itoa(i)
+		if len(opt.Select) != 0 && !slices.ContainsFunc(opt.Select, func(target string) bool {
+			return matchTarget(name, moduleType(module), target)
+		}) {
+			continue
+		}
+		instances = append(instances, instantiate(ctx, b, module, name, opt.Restart))
+	}
+	b.instances = instances
+	var out *viewer
+	if opt.Stdout != nil {
+		out = b.addViewer(instances, opt.Bar, false)
+	} else {
+		b.viewersMu.Lock()
+		b.updateStopped()
+		b.viewersMu.Unlock()
+	}
+	if opt.ControlSocket != "" {
+		if err := serveControl(ctx, opt.ControlSocket, opt.Logger.With("component", "control"), b); err != nil {
+			if opt.Stdout == nil {
+				return fmt.Errorf("control socket: %w", err)
+			}
+			opt.Logger.Warn("failed to create control socket", "path", opt.ControlSocket, "error", err)
+		}
+	}
+	if opt.Stdin != nil {
+		go func() {
+			sc := bufio.NewScanner(opt.Stdin)
+			for sc.Scan() {
+				event, ok, err := opt.Output.ParseEvent(sc.Bytes())
+				if err != nil {
+					opt.Logger.Warn("invalid event line", "line", sc.Text(), "error", err)
+					continue
+				}
+				if !ok {
+					continue
 				}
-			case contSignal:
 				for _, instance := range instances {
-					instance.SendStopped(false)
+					instance.SendEvent(event)
+				}
+			}
+			if err := sc.Err(); err != nil {
+				cancel(fmt.Errorf("read stdin: %w", err))
+			} else {
+				cancel(io.EOF)
+			}
+		}()
+	}
+	for _, sig := range []syscall.Signal{opt.StopSignal, opt.ContSignal} {
+		if sig != 0 && out != nil {
+			b.signals.Handle(sig)
+		}
+	}
+	go func() {
+		for {
+			select {
+			case sig := <-b.signals.C():
+				switch {
+				case opt.StopSignal != 0 && sig == opt.StopSignal:
+					b.setStopped(out, true)
+				case opt.ContSignal != 0 && sig == opt.ContSignal:
+					b.setStopped(out, false)
+				default:
+					b.signals.Dispatch(sig)
 				}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
-	if !slices.Contains(os.Environ(), restartEnv) {
-		os.Stdout.Write(append(barproto.Init{
-			StopSignal:  stopSignal,
-			ContSignal:  contSignal,
-			ClickEvents: true,
-		}.AppendJSON(nil), "\n[[]\n"...))
+	var (
+		buf    []byte
+		blocks []barproto.Block
+		byName = make(map[string]*instanceImpl, len(instances))
+	)
+	for _, instance := range instances {
+		byName[instance.name] = instance
+	}
+	buttons := func(block barproto.Block) uint32 {
+		if instance, ok := byName[block.Name]; ok {
+			return instance.buttons(block.Instance)
+		}
+		return 0
+	}
+	if out != nil && (!opt.WatchBinary || !slices.Contains(os.Environ(), restartEnv)) {
+		buf = opt.Output.AppendHeader(buf, barproto.Init{
+			StopSignal:  opt.StopSignal,
+			ContSignal:  opt.ContSignal,
+			ClickEvents: opt.Stdin != nil,
+		})
+		if _, err := opt.Stdout.Write(buf); err != nil {
+			return fmt.Errorf("write header: %w", err)
+		}
 	}
 	for render := false; ; {
 		if render {
@@ -480,12 +1134,21 @@ func Main(tickRate time.Duration, modules ...Module) {
 			}
 			render = false
 
-			os.Stdout.WriteString(",[")
-			var comma bool
-			for _, instance := range instances {
-				comma = instance.WriteTo(os.Stdout, comma)
+			if out != nil {
+				blocks = blocks[:0]
+				for _, instance := range instances {
+					blocks = instance.AppendTo(blocks)
+				}
+				if o, ok := opt.Output.(buttonsOutput); ok {
+					buf = o.appendStatus(buf[:0], blocks, buttons)
+				} else {
+					buf = opt.Output.AppendStatus(buf[:0], blocks)
+				}
+				if _, err := opt.Stdout.Write(buf); err != nil {
+					return fmt.Errorf("write status line: %w", err)
+				}
 			}
-			os.Stdout.WriteString("]\n")
+			b.rendered()
 		}
 		select {
 		case <-invalidateNowCh:
@@ -493,16 +1156,28 @@ func Main(tickRate time.Duration, modules ...Module) {
 			continue
 		case <-invalidateCh:
 			render = true
+		case <-ctx.Done():
+			return runErr(ctx)
 		}
 		if delayer == nil {
-			delayer = time.NewTimer(updateDelay)
+			delayer = time.NewTimer(opt.UpdateDelay)
 		} else {
-			delayer.Reset(updateDelay)
+			delayer.Reset(opt.UpdateDelay)
 		}
 		select {
 		case <-delayer.C:
 		case <-invalidateNowCh:
 			render = true
+		case <-ctx.Done():
+			return runErr(ctx)
 		}
 	}
 }
+
+// runErr returns the reason the bar stopped, or nil if it was a clean exit.
+func runErr(ctx context.Context) error {
+	if err := context.Cause(ctx); err != io.EOF && err != context.Canceled && err != context.DeadlineExceeded {
+		return err
+	}
+	return nil
+}
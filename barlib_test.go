@@ -0,0 +1,452 @@
+package barlib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestRun(t *testing.T) {
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(context.Background(), Options{
+			Stdin:    stdinR,
+			Stdout:   stdoutW,
+			TickRate: time.Second,
+		}, ModuleFunc(func(i Instance) error {
+			text := "init"
+			for {
+				i.Update(true, func(render Renderer) {
+					render(barproto.Block{
+						Instance: "text",
+						FullText: text,
+					})
+				})
+				event := <-i.Event()
+				text = event.Instance
+			}
+		}))
+	}()
+
+	sc := bufio.NewScanner(stdoutR)
+	expect := func(line string) {
+		t.Helper()
+		if !sc.Scan() {
+			t.Fatalf("expected line %q, got error %v", line, sc.Err())
+		}
+		if sc.Text() != line {
+			t.Fatalf("expected line %q, got %q", line, sc.Text())
+		}
+	}
+	expect(`{"version":1,"click_events":true}`)
+	expect(`[[]`)
+	expect(`,[{"full_text":"init","name":"0","instance":"text","separator":false,"separator_block_width":0}]`)
+
+	io.WriteString(stdinW, "[\n")
+	io.WriteString(stdinW, `{"name":"0","instance":"clicked","button":1}`+"\n")
+	expect(`,[{"full_text":"clicked","name":"0","instance":"text","separator":false,"separator_block_width":0}]`)
+
+	stdinW.Close()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("run did not return after stdin was closed")
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, Options{
+			Stdout:   io.Discard,
+			TickRate: time.Second,
+		})
+	}()
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("run did not return after the context was cancelled")
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	for _, opt := range []Options{
+		{TickRate: time.Second},
+		{Stdout: io.Discard},
+	} {
+		if err := Run(context.Background(), opt); err == nil {
+			t.Errorf("expected error for %+v", opt)
+		}
+	}
+}
+
+func TestRunRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	stdoutR, stdoutW := io.Pipe()
+	go func() {
+		stdoutW.CloseWithError(Run(ctx, Options{
+			Stdout:   stdoutW,
+			Bar:      barproto.I3bar,
+			TickRate: time.Second,
+			Restart: RestartPolicy{
+				Auto:        true,
+				Backoff:     time.Millisecond * 10,
+				MaxAttempts: 2,
+			},
+		}, ModuleFunc(func(i Instance) error {
+			return fmt.Errorf("test")
+		}), WithRestart(ModuleFunc(func(i Instance) error {
+			return fmt.Errorf("test")
+		}), RestartPolicy{})))
+	}()
+
+	var restarting bool
+	sc := bufio.NewScanner(stdoutR)
+	for sc.Scan() {
+		switch line := sc.Text(); {
+		case strings.Contains(line, `fatal: test (restarting in 1s) ","short_text":"ERR","name":"0"`):
+			restarting = true
+		case strings.Contains(line, `fatal: test (restarting in`):
+			t.Fatalf("unexpected restart line %q", line)
+		case strings.Contains(line, `fatal: test ","short_text":"ERR","name":"0"`):
+			if !restarting {
+				t.Fatalf("expected automatic restarts before waiting for a click")
+			}
+			if !strings.Contains(line, `fatal: test ","short_text":"ERR","name":"1"`) {
+				t.Fatalf("expected second module to wait for a click, got %q", line)
+			}
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for automatic restarts to be exhausted")
+}
+
+func TestRunRestartContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	runs := make(chan Instance, 2)
+	go Run(ctx, Options{
+		Stdout:   io.Discard,
+		TickRate: time.Second,
+		Restart: RestartPolicy{
+			Auto:        true,
+			Backoff:     time.Millisecond * 10,
+			MaxAttempts: 1,
+		},
+	}, ModuleFunc(func(i Instance) error {
+		runs <- i
+		return fmt.Errorf("test")
+	}))
+
+	var prev Instance
+	for range 2 {
+		select {
+		case i := <-runs:
+			if prev != nil {
+				if prev.Context().Err() == nil {
+					t.Errorf("expected context from previous run to stay cancelled")
+				}
+				if prev.Context() == i.Context() {
+					t.Errorf("expected new context for restarted run")
+				}
+			}
+			prev = i
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for module to run")
+		}
+	}
+}
+
+func TestRunUnknownBar(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	stdoutR, stdoutW := io.Pipe()
+	go func() {
+		stdoutW.CloseWithError(Run(ctx, Options{
+			Stdout:   stdoutW,
+			TickRate: time.Second,
+		}, ModuleFunc(func(i Instance) error {
+			return fmt.Errorf("test")
+		})))
+	}()
+
+	sc := bufio.NewScanner(stdoutR)
+	for sc.Scan() {
+		if line := sc.Text(); strings.Contains(line, `fatal: test`) {
+			if !strings.Contains(line, `"background":"#FF0000"`) || !strings.Contains(line, `"border_top":`) {
+				t.Fatalf("expected error block with block colors on an unknown bar, got %q", line)
+			}
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for error block")
+}
+
+func TestTickResume(t *testing.T) {
+	resumed := make(chan struct{}, 1)
+	d := newTickDivider(time.Hour, func() {
+		resumed <- struct{}{}
+	})
+	defer d.Stop()
+
+	d.Resume() // idle
+	select {
+	case <-resumed:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected resume callback while idle")
+	}
+
+	var g int
+	s := d.Tick(nil, &g, time.Hour*2)
+	d.Resume()
+	select {
+	case <-s:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected forced tick after resume")
+	}
+	select {
+	case <-resumed:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected resume callback")
+	}
+}
+
+func TestTickResumeOrder(t *testing.T) {
+	var (
+		g       int
+		s       <-chan uint64
+		ready   = make(chan struct{})
+		resumed = make(chan bool, 1)
+	)
+	d := newTickDivider(time.Hour, func() {
+		<-ready
+		select {
+		case <-s:
+			resumed <- false
+		default:
+			resumed <- true
+		}
+	})
+	defer d.Stop()
+
+	s = d.Tick(nil, &g, time.Hour)
+	close(ready)
+	d.Resume()
+	select {
+	case ok := <-resumed:
+		if !ok {
+			t.Errorf("expected resume callback before the forced tick")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected resume callback")
+	}
+	select {
+	case <-s:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected forced tick after resume callback")
+	}
+}
+
+func TestTickStopped(t *testing.T) {
+	resumed := make(chan struct{}, 1)
+	d := newTickDivider(time.Millisecond*10, func() {
+		resumed <- struct{}{}
+	})
+	defer d.Stop()
+
+	var g1, g2 int
+	s1 := d.Tick(nil, &g1, time.Millisecond*10)
+	s2 := d.Tick(nil, &g2, time.Millisecond*20)
+
+	select {
+	case <-s1:
+	case <-time.After(time.Second):
+		t.Fatalf("expected tick")
+	}
+
+	d.SetStopped(&g1, true)
+	d.SetStopped(&g2, true)
+	time.Sleep(time.Millisecond * 15)
+	select {
+	case <-s1:
+	default:
+	}
+	select {
+	case <-s2:
+	default:
+	}
+	time.Sleep(time.Millisecond * 50)
+	select {
+	case <-s1:
+		t.Errorf("unexpected tick while stopped")
+	case <-s2:
+		t.Errorf("unexpected tick while stopped")
+	default:
+	}
+
+	d.Resume() // idle since everything is stopped
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected resume callback while stopped")
+	}
+	select {
+	case <-s1:
+		t.Errorf("unexpected forced tick while stopped")
+	case <-s2:
+		t.Errorf("unexpected forced tick while stopped")
+	default:
+	}
+
+	d.SetStopped(&g1, false)
+	select {
+	case <-s1:
+	default:
+		t.Errorf("expected catch-up tick")
+	}
+	select {
+	case <-s2:
+		t.Errorf("unexpected tick for stopped group")
+	default:
+	}
+	d.SetStopped(&g2, false)
+	select {
+	case <-s2:
+	default:
+		t.Errorf("expected catch-up tick")
+	}
+
+	select {
+	case <-s1:
+	case <-time.After(time.Second):
+		t.Fatalf("expected ticks to continue after resuming")
+	}
+}
+
+func TestRunStopCont(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// don't get killed if the signals arrive before the bar handles them
+	ignore := make(chan os.Signal, 1)
+	signal.Notify(ignore, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(ignore)
+
+	var (
+		ticks   = make(chan uint64, 64)
+		stopped = make(chan bool, 8)
+	)
+	go Run(ctx, Options{
+		Stdout:     io.Discard,
+		TickRate:   time.Millisecond * 10,
+		StopSignal: syscall.SIGUSR1,
+		ContSignal: syscall.SIGUSR2,
+	}, ModuleFunc(func(i Instance) error {
+		tick := i.Tick(time.Millisecond * 10)
+		for {
+			select {
+			case n := <-tick:
+				ticks <- n
+			case <-i.Stopped():
+				stopped <- i.IsStopped()
+			case <-i.Context().Done():
+				return i.Context().Err()
+			}
+		}
+	}))
+	select {
+	case <-ticks:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("expected tick")
+	}
+
+	send := func(sig syscall.Signal, exp bool) {
+		t.Helper()
+		for range 50 {
+			if err := syscall.Kill(os.Getpid(), sig); err != nil {
+				t.Fatalf("send signal: %v", err)
+			}
+			select {
+			case act := <-stopped:
+				if act != exp {
+					t.Fatalf("expected stopped=%t, got %t", exp, act)
+				}
+				return
+			case <-time.After(time.Millisecond * 100):
+			}
+		}
+		t.Fatalf("module was not notified after %s", sig)
+	}
+
+	send(syscall.SIGUSR1, true)
+	time.Sleep(time.Millisecond * 15)
+	for len(ticks) != 0 {
+		<-ticks
+	}
+	time.Sleep(time.Millisecond * 100)
+	if n := len(ticks); n != 0 {
+		t.Errorf("unexpected ticks while stopped (%d)", n)
+	}
+
+	send(syscall.SIGUSR2, false)
+	for range 2 { // catch-up tick, then the normal ones
+		select {
+		case <-ticks:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("expected ticks after continuing")
+		}
+	}
+}
+
+func TestRunSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscribed := make(chan struct{})
+	signalled := make(chan struct{})
+	go Run(ctx, Options{
+		Stdout:   io.Discard,
+		TickRate: time.Second,
+	}, ModuleFunc(func(i Instance) error {
+		sig := i.Signal(5)
+		close(subscribed)
+		<-sig
+		close(signalled)
+		<-i.Context().Done()
+		return i.Context().Err()
+	}))
+
+	<-subscribed
+	if err := syscall.Kill(os.Getpid(), syscall.Signal(sigRTMin+5)); err != nil {
+		t.Fatalf("send signal: %v", err)
+	}
+	select {
+	case <-signalled:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("module did not receive signal")
+	}
+}
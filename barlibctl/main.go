@@ -0,0 +1,159 @@
+// Command barlibctl controls running barlib status bars over their control
+// sockets.
+//
+// By default, commands are sent to all status bars using the default control
+// socket path for the current user.
+//
+//	barlibctl list
+//	barlibctl event Backlight '{"button":4}'
+//	barlibctl click PulseAudio 1 snk_vol
+//	barlibctl release PulseAudio 1 snk_vol
+//	barlibctl action Backlight up
+//	barlibctl redraw
+//
+// It can also be used as the status command for a bar attached to a barlib
+// daemon (see [barlib.Attach]), optionally only showing some of the modules.
+//
+//	barlibctl attach
+//	barlibctl -socket /run/user/1000/barlib.daemon.sock attach Time Battery
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/barlib"
+)
+
+func main() {
+	var (
+		socket  = flag.String("socket", "", "control socket path (default: all sockets matching "+barlib.ControlSocketGlob()+", or "+barlib.DefaultDaemonSocket()+" for attach)")
+		timeout = flag.Duration("timeout", time.Second*5, "command timeout")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options] command [args...]\n", flag.CommandLine.Name())
+		fmt.Fprintf(flag.CommandLine.Output(), "\ncommands:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  list                           list instances\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  event target json              send an i3bar click event\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  click target button [block]    send a click event for a block instance\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  release target button [block]  send a button release event for a block instance\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  action target action           send a named action\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  redraw                         redraw the bar\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  attach [target...]             run as a status command for a daemon\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ntargets are instance names or module type names (e.g., Backlight)\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\noptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "attach" {
+		path := *socket
+		if path == "" {
+			path = barlib.DefaultDaemonSocket()
+		}
+		if err := barlib.Attach(context.Background(), path, barlib.Options{
+			Stdin:      os.Stdin,
+			Stdout:     os.Stdout,
+			StopSignal: syscall.SIGUSR1,
+			ContSignal: syscall.SIGUSR2,
+			Select:     flag.Args()[1:],
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "barlibctl: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	args, err := command(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "barlibctl: %v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var sockets []string
+	if *socket != "" {
+		sockets = []string{*socket}
+	} else {
+		sockets, _ = filepath.Glob(barlib.ControlSocketGlob())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var n int
+	var failed bool
+	for _, path := range sockets {
+		lines, err := barlib.ControlCommand(ctx, path, args...)
+		if *socket == "" && errors.Is(err, syscall.ECONNREFUSED) {
+			continue // stale socket
+		}
+		n++
+		for _, line := range lines {
+			if len(sockets) > 1 {
+				fmt.Printf("%s\t%s\n", path, line)
+			} else {
+				fmt.Println(line)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "barlibctl: %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if n == 0 {
+		fmt.Fprintf(os.Stderr, "barlibctl: no running status bars found\n")
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// command validates the command line and converts it into a control command.
+func command(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command specified")
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "list", "redraw":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%s: expected no arguments", cmd)
+		}
+		return []string{cmd}, nil
+	case "event", "action":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s: expected 2 arguments", cmd)
+		}
+		return []string{cmd, args[0], args[1]}, nil
+	case "click", "release":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("%s: expected 2 or 3 arguments", cmd)
+		}
+		button, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid button %q", cmd, args[1])
+		}
+		event := `{"button":` + strconv.Itoa(button)
+		if len(args) == 3 {
+			buf, _ := json.Marshal(args[2])
+			event += `,"instance":` + string(buf)
+		}
+		if cmd == "release" {
+			event += `,"release":true`
+		}
+		event += `}`
+		return []string{"event", args[0], event}, nil
+	default:
+		return nil, fmt.Errorf("unknown command %q", strings.TrimSpace(cmd))
+	}
+}
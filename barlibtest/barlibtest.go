@@ -0,0 +1,693 @@
+// Package barlibtest implements a fake [barlib.Instance] for testing modules
+// deterministically without a bar.
+package barlibtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/barlib"
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// UpdateGolden causes AssertGolden to overwrite golden files instead of
+// comparing against them. It is set if the BARLIBTEST_UPDATE_GOLDEN
+// environment variable is not empty.
+var UpdateGolden = os.Getenv("BARLIBTEST_UPDATE_GOLDEN") != ""
+
+// WaitTimeout is the maximum amount of real time to wait for a module to
+// do something before failing the test.
+var WaitTimeout = time.Second * 5
+
+// Epoch is the virtual wall-clock time at the start of each test, which is
+// used for scheduled ticks.
+var Epoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Update is a single update submitted by a module.
+type Update struct {
+	Now    bool
+	Blocks []barproto.Block
+}
+
+// Text returns the FullText of each block.
+func (u Update) Text() []string {
+	s := make([]string, len(u.Blocks))
+	for i, b := range u.Blocks {
+		s[i] = b.FullText
+	}
+	return s
+}
+
+// AppendJSON appends the blocks as an i3bar status line.
+func (u Update) AppendJSON(b []byte) []byte {
+	b = append(b, '[')
+	for i, x := range u.Blocks {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = x.AppendJSON(b)
+	}
+	b = append(b, ']')
+	return b
+}
+
+// Instance is a fake [barlib.Instance] with a virtual clock. All methods are
+// safe for concurrent use.
+type Instance struct {
+	tb   testing.TB
+	base time.Duration
+
+	// virtual clock
+	tickm sync.Mutex
+	tickn uint64                          // number of base ticks so far
+	ticks map[chan<- uint64]uint64        // map of sub-tickers to multiple of base interval
+	tickr map[<-chan uint64]chan<- uint64 // map of sub-tickers to themselves
+	tickp uint64                          // tick the instance was stopped at
+	sched []*schedule                     // scheduled tickers
+
+	// notify
+	eventCh   chan barproto.Event
+	handleCh  chan func()
+	actionCh  chan string
+	stoppedCh chan struct{}
+	resumedCh chan struct{}
+	capsCh    chan struct{}
+	stopped   atomic.Bool
+
+	// real-time signal subscribers
+	sigm sync.Mutex
+	sigs map[int][]chan struct{}
+
+	// module state
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	// recorded updates
+	updm sync.Mutex
+	updc *sync.Cond
+	upd  []Update
+	seen int
+	updh barlib.Handlers // from the last update
+
+	// update being built
+	pendm sync.Mutex
+	pendh barlib.Handlers
+	pendu bool
+
+	// whether the test has finished
+	finished atomic.Bool
+
+	// logs to the test
+	logger *slog.Logger
+
+	// instance state
+	state barlib.State
+
+	// theme returned by Theme
+	theme barlib.Theme
+
+	// bar capabilities
+	capsm   sync.Mutex
+	caps    barproto.Capabilities
+	capsSet bool
+}
+
+var _ barlib.Instance = (*Instance)(nil)
+
+// New creates a new fake instance with the specified base tick rate.
+func New(tb testing.TB, base time.Duration) *Instance {
+	if base <= 0 {
+		tb.Fatalf("barlibtest: base tick rate %s is not positive", base)
+	}
+	i := &Instance{
+		tb:        tb,
+		base:      base,
+		ticks:     make(map[chan<- uint64]uint64),
+		tickr:     make(map[<-chan uint64]chan<- uint64),
+		eventCh:   make(chan barproto.Event, 16),
+		handleCh:  make(chan func(), 16),
+		actionCh:  make(chan string, 16),
+		stoppedCh: make(chan struct{}, 1),
+		resumedCh: make(chan struct{}, 1),
+		capsCh:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		sigs:      make(map[int][]chan struct{}),
+		theme:     barlib.I3Theme,
+	}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	i.updc = sync.NewCond(&i.updm)
+	i.logger = slog.New(slog.NewTextHandler(testWriter{i}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+	tb.Cleanup(func() {
+		i.finished.Store(true)
+		i.cancel()
+	})
+	return i
+}
+
+// Run starts m in the background. It must only be called once.
+func (i *Instance) Run(m barlib.Module) {
+	go func() {
+		defer close(i.done)
+		defer func() {
+			i.updm.Lock()
+			i.updc.Broadcast()
+			i.updm.Unlock()
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				i.err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		i.err = m.Run(i)
+		if i.err == nil {
+			i.err = fmt.Errorf("module returned without an error")
+		}
+	}()
+}
+
+// Stop cancels the instance context like the bar would when shutting down,
+// which also unregisters its tickers and signal subscriptions. It is called
+// automatically when the test finishes.
+func (i *Instance) Stop() {
+	i.cancel()
+}
+
+// Done returns a channel which is closed when the module returns.
+func (i *Instance) Done() <-chan struct{} {
+	return i.done
+}
+
+// Err returns the error the module returned, or nil if it is still running.
+func (i *Instance) Err() error {
+	select {
+	case <-i.done:
+		return i.err
+	default:
+		return nil
+	}
+}
+
+// WaitErr waits for the module to return, failing the test if it takes
+// longer than WaitTimeout.
+func (i *Instance) WaitErr() error {
+	i.tb.Helper()
+	select {
+	case <-i.done:
+		return i.err
+	case <-time.After(WaitTimeout):
+		i.tb.Fatalf("barlibtest: timed out waiting for module to return")
+		return nil
+	}
+}
+
+// Elapsed returns the total virtual time advanced.
+func (i *Instance) Elapsed() time.Duration {
+	i.tickm.Lock()
+	defer i.tickm.Unlock()
+	return time.Duration(i.tickn) * i.base
+}
+
+// Now returns the virtual wall-clock time, which is Epoch plus Elapsed.
+func (i *Instance) Now() time.Time {
+	return Epoch.Add(i.Elapsed())
+}
+
+// Advance advances the virtual clock by d, which must be a multiple of the base
+// tick rate, firing tickers like the real bar would. Like the real bar, if the
+// module doesn't receive a tick before the next one, it is missed, so tests
+// should generally advance one interval at a time and wait for the resulting
+// update.
+func (i *Instance) Advance(d time.Duration) {
+	i.tb.Helper()
+	if d < 0 || d%i.base != 0 {
+		i.tb.Fatalf("barlibtest: advance %s is not a non-negative multiple of base %s", d, i.base)
+	}
+	i.tickm.Lock()
+	defer i.tickm.Unlock()
+	for range d / i.base {
+		for s, n := range i.ticks {
+			if !i.stopped.Load() && n != 0 && i.tickn%n == 0 {
+				select {
+				case s <- i.tickn:
+				default:
+					// tick missed
+				}
+			}
+		}
+		i.tickn++
+		i.fireSchedules()
+	}
+}
+
+type schedule struct {
+	ch chan time.Time
+	t  time.Time
+	s  barlib.Schedule
+}
+
+// fireSchedules sends scheduled ticks which are due. The tick lock must be
+// held.
+func (i *Instance) fireSchedules() {
+	if i.stopped.Load() {
+		return
+	}
+	now := Epoch.Add(time.Duration(i.tickn) * i.base)
+	for _, x := range i.sched {
+		if !x.t.IsZero() && !now.Before(x.t) {
+			select {
+			case x.ch <- x.t:
+			default:
+				// tick missed
+			}
+			if x.s != nil {
+				x.t = x.s.Next(now)
+			} else {
+				x.t = time.Time{}
+			}
+		}
+	}
+}
+
+// Send sends an event to the module, returning false if the buffer is full.
+// Like the real bar, it is routed to the handlers attached to blocks in the
+// last update if possible.
+func (i *Instance) Send(event barproto.Event) bool {
+	i.updm.Lock()
+	fn, ok := i.updh.Route(event)
+	i.updm.Unlock()
+	if ok {
+		select {
+		case i.handleCh <- fn:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case i.eventCh <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Click sends a click event for the specified block instance and button.
+func (i *Instance) Click(instance string, button int) {
+	i.tb.Helper()
+	if !i.Send(barproto.Event{
+		Instance: instance,
+		Button:   button,
+	}) {
+		i.tb.Fatalf("barlibtest: event buffer full")
+	}
+}
+
+// Act sends a named action to the module.
+func (i *Instance) Act(action string) {
+	i.tb.Helper()
+	select {
+	case i.actionCh <- action:
+	default:
+		i.tb.Fatalf("barlibtest: action buffer full")
+	}
+}
+
+// Raise notifies subscribers to SIGRTMIN+n.
+func (i *Instance) Raise(n int) {
+	i.sigm.Lock()
+	defer i.sigm.Unlock()
+	for _, s := range i.sigs[n] {
+		select {
+		case s <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SetTheme sets the theme returned by Theme. It defaults to [barlib.I3Theme],
+// and must be called before Run.
+func (i *Instance) SetTheme(t barlib.Theme) {
+	i.theme = t
+}
+
+// SetCapabilities sets the capabilities returned by Capabilities. It defaults
+// to the zero value. Until it is called, the bar is treated as unknown, so
+// Theme isn't adjusted for the capabilities. Like the real bar, the module is
+// notified if the capabilities or theme changed.
+func (i *Instance) SetCapabilities(c barproto.Capabilities) {
+	i.capsm.Lock()
+	prev, theme := i.caps, i.themeLocked()
+	i.caps, i.capsSet = c, true
+	changed := prev != c || i.themeLocked() != theme
+	i.capsm.Unlock()
+	if changed {
+		select {
+		case i.capsCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SetStopped sets whether the bar is stopped and notifies the module. Like the
+// real bar, ticks are suspended while stopped, and a single tick is sent when
+// continued if any were missed.
+func (i *Instance) SetStopped(stopped bool) {
+	i.tickm.Lock()
+	if stopped && !i.stopped.Load() {
+		i.tickp = i.tickn
+	}
+	if !stopped && i.stopped.Load() {
+		for s, n := range i.ticks {
+			if n != 0 && (i.tickp+n-1)/n*n < i.tickn {
+				select {
+				case s <- (i.tickn - 1) / n * n:
+				default:
+				}
+			}
+		}
+	}
+	i.stopped.Store(stopped)
+	i.fireSchedules()
+	i.tickm.Unlock()
+	select {
+	case i.stoppedCh <- struct{}{}:
+	default:
+	}
+}
+
+// Resume simulates the system resuming from sleep, notifying the module, then
+// sending a tick to all tickers (unless stopped).
+func (i *Instance) Resume() {
+	select {
+	case i.resumedCh <- struct{}{}:
+	default:
+	}
+	i.tickm.Lock()
+	if !i.stopped.Load() {
+		for s, n := range i.ticks {
+			if n != 0 {
+				select {
+				case s <- i.tickn:
+				default:
+				}
+			}
+		}
+	}
+	i.tickm.Unlock()
+}
+
+// Updates returns all updates submitted so far.
+func (i *Instance) Updates() []Update {
+	i.updm.Lock()
+	defer i.updm.Unlock()
+	return append([]Update(nil), i.upd...)
+}
+
+// Last returns the most recent update, or the zero value if there are none.
+func (i *Instance) Last() Update {
+	i.updm.Lock()
+	defer i.updm.Unlock()
+	if len(i.upd) == 0 {
+		return Update{}
+	}
+	return i.upd[len(i.upd)-1]
+}
+
+// Wait waits for the next update which hasn't been returned by Wait yet,
+// failing the test if the module returns or it takes longer than WaitTimeout.
+func (i *Instance) Wait() Update {
+	i.tb.Helper()
+
+	timeout := time.AfterFunc(WaitTimeout, func() {
+		i.updm.Lock()
+		i.updc.Broadcast()
+		i.updm.Unlock()
+	})
+	defer timeout.Stop()
+
+	deadline := time.Now().Add(WaitTimeout)
+
+	i.updm.Lock()
+	defer i.updm.Unlock()
+	for i.seen >= len(i.upd) {
+		select {
+		case <-i.done:
+			i.tb.Fatalf("barlibtest: module returned while waiting for update: %v", i.err)
+		default:
+		}
+		if !time.Now().Before(deadline) {
+			i.tb.Fatalf("barlibtest: timed out waiting for update")
+		}
+		i.updc.Wait()
+	}
+	u := i.upd[i.seen]
+	i.seen++
+	return u
+}
+
+// AssertText asserts that the FullText of the blocks from the most recent
+// update match.
+func (i *Instance) AssertText(want ...string) {
+	i.tb.Helper()
+	if got := i.Last().Text(); !reflect.DeepEqual(got, want) && (len(got) != 0 || len(want) != 0) {
+		i.tb.Errorf("barlibtest: expected text %q, got %q", want, got)
+	}
+}
+
+// AssertBlocks asserts that the blocks from the most recent update match.
+func (i *Instance) AssertBlocks(want ...barproto.Block) {
+	i.tb.Helper()
+	if got := i.Last(); !reflect.DeepEqual(got.Blocks, want) && (len(got.Blocks) != 0 || len(want) != 0) {
+		i.tb.Errorf("barlibtest: expected blocks:\n\t%s\ngot:\n\t%s", Update{Blocks: want}.AppendJSON(nil), got.AppendJSON(nil))
+	}
+}
+
+// AssertGolden asserts that all updates submitted so far match the golden
+// file testdata/name.golden, which contains one status line per update. If
+// UpdateGolden is true, the file is written instead.
+func (i *Instance) AssertGolden(name string) {
+	i.tb.Helper()
+
+	var b []byte
+	for _, u := range i.Updates() {
+		if u.Now {
+			b = append(b, '!')
+		}
+		b = u.AppendJSON(b)
+		b = append(b, '\n')
+	}
+
+	fn := filepath.Join("testdata", name+".golden")
+	if UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(fn), 0777); err != nil {
+			i.tb.Fatalf("barlibtest: update golden file: %v", err)
+		}
+		if err := os.WriteFile(fn, b, 0666); err != nil {
+			i.tb.Fatalf("barlibtest: update golden file: %v", err)
+		}
+		return
+	}
+
+	exp, err := os.ReadFile(fn)
+	if err != nil {
+		i.tb.Fatalf("barlibtest: read golden file: %v", err)
+	}
+	if !bytes.Equal(b, exp) {
+		i.tb.Errorf("barlibtest: output does not match %s (set BARLIBTEST_UPDATE_GOLDEN=1 to update):\n--- expected\n%s--- got\n%s", fn, exp, b)
+	}
+}
+
+func (i *Instance) Tick(interval time.Duration) <-chan uint64 {
+	n := i.interval(interval)
+	s := make(chan uint64, 1)
+	i.tickm.Lock()
+	i.ticks[s] = n
+	i.tickr[s] = s
+	i.tickm.Unlock()
+	go func() {
+		<-i.ctx.Done()
+		i.tickm.Lock()
+		delete(i.ticks, s)
+		delete(i.tickr, s)
+		i.tickm.Unlock()
+	}()
+	return s
+}
+
+func (i *Instance) TickReset(s <-chan uint64, interval time.Duration) {
+	n := i.interval(interval)
+	i.tickm.Lock()
+	if s, ok := i.tickr[s]; ok {
+		i.ticks[s] = n
+	}
+	i.tickm.Unlock()
+}
+
+func (i *Instance) TickAligned(interval time.Duration) <-chan time.Time {
+	return i.Schedule(barlib.Aligned(interval))
+}
+
+func (i *Instance) At(t time.Time) <-chan time.Time {
+	return i.addSchedule(t, nil)
+}
+
+func (i *Instance) Schedule(s barlib.Schedule) <-chan time.Time {
+	return i.addSchedule(s.Next(i.Now()), s)
+}
+
+func (i *Instance) addSchedule(t time.Time, s barlib.Schedule) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	i.tickm.Lock()
+	defer i.tickm.Unlock()
+	i.sched = append(i.sched, &schedule{ch, t, s})
+	i.fireSchedules()
+	return ch
+}
+
+func (i *Instance) interval(interval time.Duration) uint64 {
+	if interval < 0 {
+		panic(fmt.Errorf("tick interval %s is negative", interval))
+	}
+	if interval%i.base != 0 {
+		panic(fmt.Errorf("tick interval %s is not a multiple of base %s", interval, i.base))
+	}
+	return uint64(interval / i.base)
+}
+
+func (i *Instance) Update(now bool, fn func(render barlib.Renderer)) {
+	i.pendm.Lock()
+	defer i.pendm.Unlock()
+
+	var u Update
+	u.Now = now
+	i.pendh = barlib.Handlers{}
+	i.pendu = true
+	fn(func(b barproto.Block) {
+		u.Blocks = append(u.Blocks, b)
+	})
+	i.pendu = false
+
+	i.updm.Lock()
+	i.updh = i.pendh
+	i.upd = append(i.upd, u)
+	i.updc.Broadcast()
+	i.updm.Unlock()
+}
+
+func (i *Instance) Attach(instance string, handlers ...barlib.Handler) {
+	if !i.pendu {
+		panic("barlibtest: Attach called outside of Update")
+	}
+	i.pendh.Add(instance, handlers...)
+}
+
+func (i *Instance) IsStopped() bool {
+	return i.stopped.Load()
+}
+
+func (i *Instance) Event() <-chan barproto.Event {
+	return i.eventCh
+}
+
+func (i *Instance) Handle() <-chan func() {
+	return i.handleCh
+}
+
+func (i *Instance) Stopped() <-chan struct{} {
+	return i.stoppedCh
+}
+
+func (i *Instance) Resumed() <-chan struct{} {
+	return i.resumedCh
+}
+
+func (i *Instance) Signal(n int) <-chan struct{} {
+	if n < 0 || n > 30 {
+		panic(fmt.Errorf("real-time signal SIGRTMIN+%d out of range", n))
+	}
+	s := make(chan struct{}, 1)
+	i.sigm.Lock()
+	i.sigs[n] = append(i.sigs[n], s)
+	i.sigm.Unlock()
+	go func() {
+		<-i.ctx.Done()
+		i.sigm.Lock()
+		i.sigs[n] = slices.DeleteFunc(i.sigs[n], func(x chan struct{}) bool {
+			return x == s
+		})
+		i.sigm.Unlock()
+	}()
+	return s
+}
+
+func (i *Instance) Action() <-chan string {
+	return i.actionCh
+}
+
+func (i *Instance) Context() context.Context {
+	return i.ctx
+}
+
+func (i *Instance) Logger() *slog.Logger {
+	return i.logger
+}
+
+// State returns the in-memory instance state. It can be set before calling Run
+// to test restoring state.
+func (i *Instance) State() *barlib.State {
+	return &i.state
+}
+
+func (i *Instance) Theme() barlib.Theme {
+	i.capsm.Lock()
+	defer i.capsm.Unlock()
+	return i.themeLocked()
+}
+
+// themeLocked returns the theme adjusted for the capabilities. The
+// capabilities lock must be held.
+func (i *Instance) themeLocked() barlib.Theme {
+	if !i.capsSet {
+		return i.theme
+	}
+	return i.theme.For(i.caps)
+}
+
+func (i *Instance) Capabilities() barproto.Capabilities {
+	i.capsm.Lock()
+	defer i.capsm.Unlock()
+	return i.caps
+}
+
+func (i *Instance) CapabilitiesChanged() <-chan struct{} {
+	return i.capsCh
+}
+
+func (i *Instance) Debug(format string, a ...any) {
+	i.logger.Info(fmt.Sprintf(format, a...))
+}
+
+type testWriter struct {
+	i *Instance
+}
+
+func (w testWriter) Write(b []byte) (int, error) {
+	if !w.i.finished.Load() {
+		w.i.tb.Log(string(bytes.TrimSuffix(b, []byte{'\n'})))
+	}
+	return len(b), nil
+}
@@ -0,0 +1,95 @@
+package barproto
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// Bar is a status bar implementation.
+type Bar string
+
+const (
+	UnknownBar Bar = ""
+	I3bar      Bar = "i3bar"
+	Swaybar    Bar = "swaybar"
+	I3barRiver Bar = "i3bar-river"
+)
+
+// Capabilities describes optional protocol features supported by a bar. The
+// zero value only includes the features supported by all bars.
+type Capabilities struct {
+	BlockColors bool // Block.Background, Block.Border, and the border widths
+	ClickCoords bool // Event.RelativeX, RelativeY, Width, and Height
+	ClickScale  bool // Event.Scale
+}
+
+// Capabilities returns the capabilities of b. If b is unknown, the zero value
+// is returned.
+func (b Bar) Capabilities() Capabilities {
+	switch b {
+	case I3bar:
+		return Capabilities{BlockColors: true, ClickCoords: true}
+	case Swaybar:
+		return Capabilities{BlockColors: true, ClickCoords: true, ClickScale: true}
+	case I3barRiver:
+		return Capabilities{BlockColors: true}
+	default:
+		return Capabilities{}
+	}
+}
+
+// And returns the capabilities supported by both c and o.
+func (c Capabilities) And(o Capabilities) Capabilities {
+	return Capabilities{
+		BlockColors: c.BlockColors && o.BlockColors,
+		ClickCoords: c.ClickCoords && o.ClickCoords,
+		ClickScale:  c.ClickScale && o.ClickScale,
+	}
+}
+
+// DetectBar detects the bar which started the current process by checking the
+// names of the parent processes, skipping shells since bars run status
+// commands with sh -c. If it can't be detected, UnknownBar is returned.
+func DetectBar() Bar {
+	return detectBar(os.Getppid(), procStat)
+}
+
+func detectBar(pid int, stat func(pid int) (comm string, ppid int, ok bool)) Bar {
+	for depth := 0; pid > 1 && depth < 4; depth++ {
+		comm, ppid, ok := stat(pid)
+		if !ok {
+			break
+		}
+		switch comm {
+		case string(I3bar), string(Swaybar), string(I3barRiver):
+			return Bar(comm)
+		case "sh", "bash", "dash", "zsh", "fish", "barlibctl":
+			pid = ppid
+			continue
+		}
+		break
+	}
+	return UnknownBar
+}
+
+// procStat reads the command name and parent pid of a process from procfs.
+func procStat(pid int) (comm string, ppid int, ok bool) {
+	buf, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", 0, false
+	}
+	// pid (comm) state ppid ...
+	i, j := bytes.IndexByte(buf, '('), bytes.LastIndexByte(buf, ')')
+	if i == -1 || j < i {
+		return "", 0, false
+	}
+	f := bytes.Fields(buf[j+1:])
+	if len(f) < 2 {
+		return "", 0, false
+	}
+	if ppid, err = strconv.Atoi(string(f[1])); err != nil {
+		return "", 0, false
+	}
+	return string(buf[i+1 : j]), ppid, true
+}
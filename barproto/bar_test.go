@@ -0,0 +1,59 @@
+package barproto
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDetectBar(t *testing.T) {
+	procs := map[int]struct {
+		Comm string
+		PPID int
+	}{
+		10: {"swaybar", 1},
+		11: {"sh", 10},
+		12: {"barlibctl", 11},
+		20: {"i3bar", 1},
+		21: {"i3status-custom", 20},
+		30: {"sh", 1},
+		40: {"i3bar-river", 1},
+		41: {"bash", 40},
+		42: {"sh", 41},
+		43: {"sh", 42},
+		44: {"sh", 43},
+	}
+	stat := func(pid int) (string, int, bool) {
+		p, ok := procs[pid]
+		return p.Comm, p.PPID, ok
+	}
+	for pid, exp := range map[int]Bar{
+		10: Swaybar,
+		11: Swaybar,
+		12: Swaybar,
+		20: I3bar,
+		21: UnknownBar,
+		30: UnknownBar,
+		42: I3barRiver,
+		44: UnknownBar, // too deep
+		99: UnknownBar,
+	} {
+		if act := detectBar(pid, stat); act != exp {
+			t.Errorf("pid %d: expected %q, got %q", pid, exp, act)
+		}
+	}
+
+	if comm, ppid, ok := procStat(os.Getpid()); !ok {
+		t.Skip("procfs not available")
+	} else if comm == "" || ppid != os.Getppid() {
+		t.Errorf("procStat: got comm=%q ppid=%d", comm, ppid)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	if c := Swaybar.Capabilities().And(I3bar.Capabilities()); c != I3bar.Capabilities() {
+		t.Errorf("expected swaybar and i3bar to have i3bar capabilities, got %+v", c)
+	}
+	if c := UnknownBar.Capabilities().And(Swaybar.Capabilities()); c != (Capabilities{}) {
+		t.Errorf("expected unknown bar to have no capabilities, got %+v", c)
+	}
+}
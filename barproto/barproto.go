@@ -4,6 +4,8 @@
 package barproto
 
 import (
+	"fmt"
+	"math"
 	"slices"
 	"strconv"
 	"syscall"
@@ -12,8 +14,18 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// Version is the protocol version written in the header. Newer fields are
+// optional and ignored by bars which don't support them (see [Capabilities]).
 const Version = 1 // i3 v4.3+, last tested on v4.23
 
+// DefaultSeparatorBlockWidth is the separator block width used by i3bar and
+// swaybar when it isn't specified.
+const DefaultSeparatorBlockWidth = 9
+
+// ZeroSeparatorBlockWidth is a [Block.SeparatorBlockWidth] for an explicit zero
+// width, which can't otherwise be represented if Separator is true.
+const ZeroSeparatorBlockWidth = math.MinInt
+
 // Init represents an i3bar initialization message.
 type Init struct {
 	StopSignal  syscall.Signal
@@ -43,6 +55,41 @@ func (x Init) AppendJSON(s []byte) []byte {
 	return s
 }
 
+func (x *Init) UnmarshalJSON(b []byte) error {
+	var (
+		init    Init
+		version bool
+	)
+	if err := jsonObject(b, func(key string, value gjson.Result) (err error) {
+		switch key {
+		case "version":
+			var v int
+			if v, err = jsonInt(value); err == nil && v < 1 {
+				err = fmt.Errorf("unsupported version %d", v)
+			}
+			version = true
+		case "stop_signal":
+			var v int
+			v, err = jsonInt(value)
+			init.StopSignal = syscall.Signal(v)
+		case "cont_signal":
+			var v int
+			v, err = jsonInt(value)
+			init.ContSignal = syscall.Signal(v)
+		case "click_events":
+			init.ClickEvents, err = jsonBool(value)
+		}
+		return
+	}); err != nil {
+		return fmt.Errorf("decode i3bar header: %w", err)
+	}
+	if !version {
+		return fmt.Errorf("decode i3bar header: missing version")
+	}
+	*x = init
+	return nil
+}
+
 // Event represents an i3bar event.
 type Event struct {
 	Name      string
@@ -57,64 +104,162 @@ type Event struct {
 	OutputY   int
 	Width     int
 	Height    int
+	Scale     float64 // output scale (only sent by swaybar)
+	Release   bool    // button release (not sent by i3bar or swaybar, but can be sent with barlibctl)
+}
+
+// eventModifiers maps modifier names to masks in the order i3bar sends them.
+var eventModifiers = [...]struct {
+	Name string
+	Mask int
+}{
+	{"Shift", xproto.ModMaskShift},
+	{"Lock", xproto.ModMaskLock},
+	{"Control", xproto.ModMaskControl},
+	{"Mod1", xproto.ModMask1}, // Alt
+	{"Mod2", xproto.ModMask2},
+	{"Mod3", xproto.ModMask3},
+	{"Mod4", xproto.ModMask4}, // Super
+	{"Mod5", xproto.ModMask5},
 }
 
-// FromJSON parses b without any error checking.
+// ModifierNames returns the names of the modifiers in the order i3bar sends
+// them.
+func (e Event) ModifierNames() []string {
+	var names []string
+	for _, m := range eventModifiers {
+		if e.Modifiers&m.Mask != 0 {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return e.AppendJSON(nil), nil
+}
+
+func (e Event) AppendJSON(s []byte) []byte {
+	s = append(s, `{"name":`...)
+	s = appendString(s, e.Name)
+	if v := e.Instance; v != "" {
+		s = append(s, `,"instance":`...)
+		s = appendString(s, v)
+	}
+	s = append(s, `,"button":`...)
+	s = strconv.AppendInt(s, int64(e.Button), 10)
+	s = append(s, `,"modifiers":[`...)
+	for i, name := range e.ModifierNames() {
+		if i != 0 {
+			s = append(s, ',')
+		}
+		s = appendString(s, name)
+	}
+	s = append(s, ']')
+	for _, f := range [...]struct {
+		Key   string
+		Value int
+	}{
+		{"x", e.X},
+		{"y", e.Y},
+		{"relative_x", e.RelativeX},
+		{"relative_y", e.RelativeY},
+		{"output_x", e.OutputX},
+		{"output_y", e.OutputY},
+		{"width", e.Width},
+		{"height", e.Height},
+	} {
+		s = append(s, ',')
+		s = appendString(s, f.Key)
+		s = append(s, ':')
+		s = strconv.AppendInt(s, int64(f.Value), 10)
+	}
+	if v := e.Scale; v != 0 {
+		s = append(s, `,"scale":`...)
+		s = strconv.AppendFloat(s, v, 'g', -1, 64)
+	}
+	if e.Release {
+		s = append(s, `,"release":true`...)
+	}
+	s = append(s, '}')
+	return s
+}
+
+// FromJSON parses b, leaving e unchanged if it is invalid.
+//
+// Deprecated: Use [Event.UnmarshalJSON], which returns the error.
 func (e *Event) FromJSON(b []byte) {
+	_ = e.UnmarshalJSON(b)
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
 	var event Event
-	gjson.ParseBytes(b).ForEach(func(key, value gjson.Result) bool {
-		switch key.Str {
+	if err := jsonObject(b, func(key string, value gjson.Result) (err error) {
+		switch key {
 		case "name":
-			event.Name = value.Str
+			event.Name, err = jsonString(value)
 		case "instance":
-			event.Instance = value.Str
+			event.Instance, err = jsonString(value)
 		case "button":
-			event.Button = int(value.Int())
+			event.Button, err = jsonInt(value)
+		case "release":
+			event.Release, err = jsonBool(value)
 		case "modifiers":
 			// https://github.com/i3/i3/blob/69f68dcd74df1ef306c3459558363d48fdda87d2/i3bar/src/child.c#L850 (send_block_clicked)
 			// xmodmap
+			if !value.IsArray() {
+				return fmt.Errorf("expected array, got %s", value.Type)
+			}
 			value.ForEach(func(_, value gjson.Result) bool {
-				switch value.Str {
-				case "Shift":
-					event.Modifiers |= xproto.ModMaskShift
-				case "Control":
-					event.Modifiers |= xproto.ModMaskControl
-				case "Mod1": // Alt
-					event.Modifiers |= xproto.ModMask1
-				case "Mod2":
-					event.Modifiers |= xproto.ModMask2
-				case "Mod3":
-					event.Modifiers |= xproto.ModMask3
-				case "Mod4": // Super
-					event.Modifiers |= xproto.ModMask4
-				case "Mod5":
-					event.Modifiers |= xproto.ModMask5
+				var mod string
+				if mod, err = jsonString(value); err != nil {
+					return false
+				}
+				for _, m := range eventModifiers {
+					if m.Name == mod {
+						event.Modifiers |= m.Mask
+					}
 				}
 				return true
 			})
 		case "x":
-			event.X = int(value.Int())
+			event.X, err = jsonInt(value)
 		case "y":
-			event.Y = int(value.Int())
+			event.Y, err = jsonInt(value)
 		case "relative_x":
-			event.RelativeX = int(value.Int())
+			event.RelativeX, err = jsonInt(value)
 		case "relative_y":
-			event.RelativeY = int(value.Int())
+			event.RelativeY, err = jsonInt(value)
 		case "output_x":
-			event.OutputX = int(value.Int())
+			event.OutputX, err = jsonInt(value)
 		case "output_y":
-			event.OutputY = int(value.Int())
+			event.OutputY, err = jsonInt(value)
 		case "width":
-			event.Width = int(value.Int())
+			event.Width, err = jsonInt(value)
 		case "height":
-			event.Height = int(value.Int())
+			event.Height, err = jsonInt(value)
+		case "scale":
+			if value.Type != gjson.Number {
+				return fmt.Errorf("expected number, got %s", value.Type)
+			}
+			event.Scale = value.Num
 		}
-		return true
-	})
+		return
+	}); err != nil {
+		return fmt.Errorf("decode i3bar event: %w", err)
+	}
 	*e = event
+	return nil
 }
 
-// Block represents an i3bar block.
+// Block represents an i3bar block. Background, Border, and the border widths
+// are ignored by bars without [Capabilities.BlockColors].
+//
+// SeparatorBlockWidth should be odd since the separator line is drawn in the
+// middle. If Separator is true, values less than or equal to zero are omitted
+// so the bar uses [DefaultSeparatorBlockWidth], and [ZeroSeparatorBlockWidth]
+// is no gap. Otherwise, only negative values are, so -1 is the default and 0
+// is no gap.
 type Block struct {
 	Name                string // optional, passed as-is for events
 	Instance            string // optional, passed as-is for events
@@ -132,7 +277,7 @@ type Block struct {
 	Align               string // left|center|right, used if smaller than MinWidth
 	Urgent              bool   // used by i3bar
 	Separator           bool   // whether to draw a separator line after the block
-	SeparatorBlockWidth int    // pixels, should be odd since line is in the middle (if Separator is true, 0 is treated as the i3bar's value, otherwise -1 is)
+	SeparatorBlockWidth int    // pixels after the block (see above for the default)
 	Pango               bool   // whether to use pango markup
 }
 
@@ -142,10 +287,10 @@ func (b Block) MarshalJSON() ([]byte, error) {
 
 func (b Block) AppendJSON(s []byte) []byte {
 	s = append(s, `{"full_text":`...)
-	s = jsonString(s, b.FullText)
+	s = appendString(s, b.FullText)
 	if v := b.ShortText; v != "" {
 		s = append(s, `,"short_text":`...)
-		s = jsonString(s, v)
+		s = appendString(s, v)
 	}
 	if v := b.Color; v != 0 {
 		s = append(s, `,"color":"`...)
@@ -154,11 +299,11 @@ func (b Block) AppendJSON(s []byte) []byte {
 	}
 	if v := b.Name; v != "" {
 		s = append(s, `,"name":`...)
-		s = jsonString(s, v)
+		s = appendString(s, v)
 	}
 	if v := b.Instance; v != "" {
 		s = append(s, `,"instance":`...)
-		s = jsonString(s, v)
+		s = appendString(s, v)
 	}
 	if v := b.Background; v != 0 {
 		s = append(s, `,"background":"`...)
@@ -200,14 +345,14 @@ func (b Block) AppendJSON(s []byte) []byte {
 	}
 	if v := b.MinWidthString; v != "" {
 		s = append(s, `,"min_width":`...)
-		s = jsonString(s, v)
+		s = appendString(s, v)
 	} else if v := b.MinWidth; v != 0 {
 		s = append(s, `,"min_width":`...)
 		s = strconv.AppendInt(s, int64(v), 10)
 	}
 	if v := b.Align; v != "" {
 		s = append(s, `,"align":`...)
-		s = jsonString(s, v)
+		s = appendString(s, v)
 	}
 	if b.Urgent {
 		s = append(s, `,"urgent":true`...)
@@ -217,10 +362,14 @@ func (b Block) AppendJSON(s []byte) []byte {
 		if v := b.SeparatorBlockWidth; v > 0 {
 			s = append(s, `,"separator_block_width":`...)
 			s = strconv.AppendInt(s, int64(v), 10)
+		} else if v == ZeroSeparatorBlockWidth {
+			s = append(s, `,"separator_block_width":0`...)
 		}
 	} else {
 		s = append(s, `,"separator":false`...)
-		if v := b.SeparatorBlockWidth; v >= 0 {
+		if v := b.SeparatorBlockWidth; v == ZeroSeparatorBlockWidth {
+			s = append(s, `,"separator_block_width":0`...)
+		} else if v >= 0 {
 			s = append(s, `,"separator_block_width":`...)
 			s = strconv.AppendInt(s, int64(v), 10)
 		}
@@ -232,6 +381,156 @@ func (b Block) AppendJSON(s []byte) []byte {
 	return s
 }
 
+// UnmarshalJSON is the inverse of AppendJSON. Unknown keys are ignored. A
+// missing separator block width is decoded as -1 if Separator is false, and an
+// explicit zero one is decoded as [ZeroSeparatorBlockWidth] if it is true.
+func (b *Block) UnmarshalJSON(s []byte) error {
+	var (
+		block              Block
+		fullText, sepWidth bool
+	)
+	block.Separator = true // i3bar default
+	if err := jsonObject(s, func(key string, value gjson.Result) (err error) {
+		switch key {
+		case "full_text":
+			block.FullText, err = jsonString(value)
+			fullText = true
+		case "short_text":
+			block.ShortText, err = jsonString(value)
+		case "color":
+			block.Color, err = jsonColor(value)
+		case "name":
+			block.Name, err = jsonString(value)
+		case "instance":
+			block.Instance, err = jsonString(value)
+		case "background":
+			block.Background, err = jsonColor(value)
+		case "border":
+			block.Border, err = jsonColor(value)
+		case "border_top":
+			block.BorderTop, err = jsonBorder(value)
+		case "border_right":
+			block.BorderRight, err = jsonBorder(value)
+		case "border_bottom":
+			block.BorderBottom, err = jsonBorder(value)
+		case "border_left":
+			block.BorderLeft, err = jsonBorder(value)
+		case "min_width":
+			if value.Type == gjson.String {
+				block.MinWidthString = value.Str
+			} else {
+				block.MinWidth, err = jsonInt(value)
+			}
+		case "align":
+			block.Align, err = jsonString(value)
+		case "urgent":
+			block.Urgent, err = jsonBool(value)
+		case "separator":
+			block.Separator, err = jsonBool(value)
+		case "separator_block_width":
+			block.SeparatorBlockWidth, err = jsonInt(value)
+			sepWidth = true
+		case "markup":
+			var v string
+			v, err = jsonString(value)
+			block.Pango = v == "pango"
+		}
+		return
+	}); err != nil {
+		return fmt.Errorf("decode i3bar block: %w", err)
+	}
+	if !fullText {
+		return fmt.Errorf("decode i3bar block: missing full_text")
+	}
+	switch {
+	case !block.Separator && !sepWidth:
+		block.SeparatorBlockWidth = -1
+	case block.Separator && sepWidth && block.SeparatorBlockWidth == 0:
+		block.SeparatorBlockWidth = ZeroSeparatorBlockWidth
+	}
+	*b = block
+	return nil
+}
+
+// jsonObject validates b and calls fn for each key of the object. If fn
+// returns an error, it is wrapped with the key.
+func jsonObject(b []byte, fn func(key string, value gjson.Result) error) error {
+	if !gjson.ValidBytes(b) {
+		return fmt.Errorf("invalid json")
+	}
+	obj := gjson.ParseBytes(b)
+	if !obj.IsObject() {
+		return fmt.Errorf("expected object, got %s", obj.Type)
+	}
+	var err error
+	obj.ForEach(func(key, value gjson.Result) bool {
+		if err = fn(key.Str, value); err != nil {
+			err = fmt.Errorf("%s: %w", key.Str, err)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func jsonString(v gjson.Result) (string, error) {
+	if v.Type != gjson.String {
+		return "", fmt.Errorf("expected string, got %s", v.Type)
+	}
+	return v.Str, nil
+}
+
+func jsonBool(v gjson.Result) (bool, error) {
+	if v.Type != gjson.True && v.Type != gjson.False {
+		return false, fmt.Errorf("expected bool, got %s", v.Type)
+	}
+	return v.Type == gjson.True, nil
+}
+
+func jsonInt(v gjson.Result) (int, error) {
+	if v.Type != gjson.Number {
+		return 0, fmt.Errorf("expected number, got %s", v.Type)
+	}
+	if v.Num != math.Trunc(v.Num) || v.Num < math.MinInt32 || v.Num > math.MaxInt32 {
+		return 0, fmt.Errorf("expected integer, got %s", v.Raw)
+	}
+	return int(v.Num), nil
+}
+
+// jsonBorder parses a border width, where 0 is stored as -1.
+func jsonBorder(v gjson.Result) (int, error) {
+	n, err := jsonInt(v)
+	if err == nil && n == 0 {
+		n = -1
+	}
+	return n, err
+}
+
+// jsonColor parses a #RRGGBB or #RRGGBBAA color.
+func jsonColor(v gjson.Result) (uint32, error) {
+	s, err := jsonString(v)
+	if err != nil {
+		return 0, err
+	}
+	return ParseColor(s)
+}
+
+// ParseColor parses a #RRGGBB or #RRGGBBAA color as used by the i3bar protocol
+// into a RRGGBBAA integer.
+func ParseColor(s string) (uint32, error) {
+	if len(s) != 7 && len(s) != 9 || s[0] != '#' {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	c, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	if len(s) == 7 {
+		c = c<<8 | 0xFF
+	}
+	return uint32(c), nil
+}
+
 func hexColor(b []byte, rrggbbaa uint32) []byte {
 	const hex = "0123456789ABCDEF"
 	b = slices.Grow(b, 9)
@@ -249,7 +548,7 @@ func hexColor(b []byte, rrggbbaa uint32) []byte {
 	return b
 }
 
-func jsonString[T ~[]byte | ~string](b []byte, s T) []byte {
+func appendString[T ~[]byte | ~string](b []byte, s T) []byte {
 	b = slices.Grow(b, len(s)+2)
 	b = append(b, '"')
 	x := 0 // note: this won't break utf-8 since we only check for < 0x20
@@ -0,0 +1,260 @@
+package barproto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func TestInitJSON(t *testing.T) {
+	for _, x := range []Init{
+		{},
+		{StopSignal: syscall.SIGUSR1, ContSignal: syscall.SIGUSR2, ClickEvents: true},
+	} {
+		var y Init
+		if err := y.UnmarshalJSON(x.AppendJSON(nil)); err != nil {
+			t.Errorf("%+v: unexpected error: %v", x, err)
+		} else if x != y {
+			t.Errorf("%+v: round-trip mismatch: %+v", x, y)
+		}
+	}
+	for _, s := range []string{
+		``,
+		`[]`,
+		`{}`,
+		`{"version":0}`,
+		`{"version":"1"}`,
+		`{"version":1,"click_events":1}`,
+		`{"version":1,"stop_signal":1.5}`,
+	} {
+		var y Init
+		if err := y.UnmarshalJSON([]byte(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestBlockJSON(t *testing.T) {
+	for _, x := range []Block{
+		{Separator: true},
+		{FullText: "test"},
+		{FullText: "test", Separator: true, SeparatorBlockWidth: 9},
+		{FullText: "test", Separator: true, SeparatorBlockWidth: ZeroSeparatorBlockWidth},
+		{FullText: "test", SeparatorBlockWidth: 0},
+		{FullText: "test", SeparatorBlockWidth: -1},
+		{
+			Name:         "name",
+			Instance:     "inst\"ance\n",
+			FullText:     "<b>test</b>",
+			ShortText:    "t",
+			Color:        0x112233FF,
+			Background:   0x44556677,
+			Border:       0x8899AAFF,
+			BorderTop:    2,
+			BorderRight:  -1,
+			BorderBottom: 3,
+			BorderLeft:   -1,
+			MinWidth:     50,
+			Align:        "center",
+			Urgent:       true,
+			Separator:    true,
+			Pango:        true,
+		},
+		{FullText: "test", MinWidthString: "xxxx", Separator: true},
+	} {
+		var y Block
+		if err := y.UnmarshalJSON(x.AppendJSON(nil)); err != nil {
+			t.Errorf("%+v: unexpected error: %v", x, err)
+		} else if x != y {
+			t.Errorf("%+v: round-trip mismatch: %+v", x, y)
+		}
+	}
+
+	for s, x := range map[string]Block{
+		`{"full_text":"a"}`:                            {FullText: "a", Separator: true},
+		`{"full_text":"a","separator_block_width":0}`:  {FullText: "a", Separator: true, SeparatorBlockWidth: ZeroSeparatorBlockWidth},
+		`{"full_text":"a","separator_block_width":15}`: {FullText: "a", Separator: true, SeparatorBlockWidth: 15},
+		`{"full_text":"a","separator":false}`:          {FullText: "a", SeparatorBlockWidth: -1},
+	} {
+		var y Block
+		if err := y.UnmarshalJSON([]byte(s)); err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+		} else if x != y {
+			t.Errorf("%s: expected %+v, got %+v", s, x, y)
+		} else if act := string(y.AppendJSON(nil)); strings.Contains(s, "separator_block_width") != strings.Contains(act, "separator_block_width") {
+			t.Errorf("%s: separator width not kept: %s", s, act)
+		}
+	}
+
+	for x, exp := range map[Block]string{
+		{FullText: "a", Separator: true, SeparatorBlockWidth: -1}:                      `{"full_text":"a","separator":true}`,
+		{FullText: "a", Separator: true, SeparatorBlockWidth: 0}:                       `{"full_text":"a","separator":true}`,
+		{FullText: "a", Separator: true, SeparatorBlockWidth: ZeroSeparatorBlockWidth}: `{"full_text":"a","separator":true,"separator_block_width":0}`,
+		{FullText: "a", SeparatorBlockWidth: ZeroSeparatorBlockWidth}:                  `{"full_text":"a","separator":false,"separator_block_width":0}`,
+	} {
+		if act := string(x.AppendJSON(nil)); act != exp {
+			t.Errorf("%+v: expected %s, got %s", x, exp, act)
+		}
+	}
+
+	var y Block
+	if err := y.UnmarshalJSON([]byte(`{"full_text":"test","_custom":{"x":1}}`)); err != nil {
+		t.Errorf("unexpected error for custom key: %v", err)
+	} else if exp := (Block{FullText: "test", Separator: true}); y != exp {
+		t.Errorf("expected default separator, got %+v", y)
+	}
+	for _, s := range []string{
+		`{}`,
+		`{"full_text":1}`,
+		`{"full_text":"","color":"red"}`,
+		`{"full_text":"","color":"#12345"}`,
+		`{"full_text":"","color":"#GGGGGG"}`,
+		`{"full_text":"","urgent":"true"}`,
+		`{"full_text":"","min_width":true}`,
+		`{"full_text":"","border_top":-1.5}`,
+		`{"full_text":"",}`,
+	} {
+		var y Block
+		if err := y.UnmarshalJSON([]byte(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	for _, x := range []struct {
+		JSON  string
+		Event Event
+		Error bool
+	}{
+		{`{"name":"a","instance":"b","button":1,"modifiers":["Shift","Mod4","Unknown"],"x":1,"y":2,"relative_x":3,"relative_y":4,"output_x":5,"output_y":6,"width":7,"height":8}`, Event{
+			Name:      "a",
+			Instance:  "b",
+			Button:    1,
+			Modifiers: xproto.ModMaskShift | xproto.ModMask4,
+			X:         1,
+			Y:         2,
+			RelativeX: 3,
+			RelativeY: 4,
+			OutputX:   5,
+			OutputY:   6,
+			Width:     7,
+			Height:    8,
+		}, false},
+		{`{"button":3,"release":true}`, Event{Button: 3, Release: true}, false},
+		{`{"button":1,"scale":1.5}`, Event{Button: 1, Scale: 1.5}, false},
+		{`{"scale":"2"}`, Event{}, true},
+		{`{"button":"1"}`, Event{}, true},
+		{`{"modifiers":"Shift"}`, Event{}, true},
+		{`{"modifiers":[1]}`, Event{}, true},
+		{`{"x":1.5}`, Event{}, true},
+		{`"x"`, Event{}, true},
+		{`{`, Event{}, true},
+	} {
+		var e Event
+		if err := e.UnmarshalJSON([]byte(x.JSON)); x.Error != (err != nil) {
+			t.Errorf("%s: unexpected error %v", x.JSON, err)
+		} else if e != x.Event {
+			t.Errorf("%s: expected %+v, got %+v", x.JSON, x.Event, e)
+		} else if err == nil {
+			var y Event
+			if err := y.UnmarshalJSON(e.AppendJSON(nil)); err != nil {
+				t.Errorf("%s: unexpected round-trip error: %v", x.JSON, err)
+			} else if e != y {
+				t.Errorf("%s: round-trip mismatch: %+v", x.JSON, y)
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		init  = Init{StopSignal: syscall.SIGUSR1, ClickEvents: true}
+		lines = [][]Block{
+			{{FullText: "a", Separator: true}, {FullText: "b", SeparatorBlockWidth: -1}},
+			{},
+			{{FullText: "c", Color: 0xFF0000FF, Separator: true}},
+			{{FullText: "d", Separator: true, SeparatorBlockWidth: ZeroSeparatorBlockWidth}, {FullText: "e", SeparatorBlockWidth: 0}},
+		}
+	)
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(nil); err == nil {
+		t.Errorf("expected error encoding before header")
+	}
+	if err := enc.Header(init); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	if _, err := dec.Next(); err == nil {
+		t.Errorf("expected error decoding before header")
+	}
+	if v, err := dec.Header(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if v != init {
+		t.Errorf("expected header %+v, got %+v", init, v)
+	}
+	if v, err := dec.Next(); err != nil || len(v) != 0 {
+		t.Errorf("expected initial empty status line, got %+v (err=%v)", v, err)
+	}
+	for _, line := range lines {
+		v, err := dec.Next()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(line) != 0 || len(v) != 0 {
+			if !reflect.DeepEqual(v, line) {
+				t.Errorf("expected %+v, got %+v", line, v)
+			}
+		}
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	for _, x := range []struct {
+		Input string
+		Error error // nil for any non-EOF error
+	}{
+		{"{\"version\":1}\n[\n[{\"full_text\":\"a\"}]\n,[{\"full_text\":\"b\"}]\n]", io.EOF},
+		{"{\"version\":1}\n[[{\"full_text\":\"a\"}],[{\"full_text\":\"b\"}],", io.EOF},
+		{"{\"version\":1}\n[[{\"full_text\":\"a\"}],[{\"full_text\":", io.ErrUnexpectedEOF},
+		{"{\"version\":1}\n[[{\"full_text\":\"a\"}],[{\"full_text\":2}]", nil},
+		{"{\"version\":1}\n[[{\"full_text\":\"a\"}],{}]", nil},
+	} {
+		dec := NewDecoder(strings.NewReader(x.Input))
+		if _, err := dec.Header(); err != nil {
+			t.Errorf("%q: unexpected error: %v", x.Input, err)
+			continue
+		}
+		var (
+			n   int
+			err error
+		)
+		for ; err == nil; n++ {
+			_, err = dec.Next()
+		}
+		if x.Error == nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				t.Errorf("%q: expected decode error, got %v", x.Input, err)
+			}
+		} else if !errors.Is(err, x.Error) {
+			t.Errorf("%q: expected %v, got %v", x.Input, x.Error, err)
+		}
+		if n != 2 && n != 3 {
+			t.Errorf("%q: expected 1-2 status lines, got %d", x.Input, n-1)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package pango builds pango markup for i3bar blocks.
+//
+// https://docs.gtk.org/Pango/pango_markup.html
+package pango
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Node is a piece of markup.
+type Node interface {
+	appendMarkup(b []byte) []byte
+	appendText(b []byte) []byte
+}
+
+// Text is plain text, which is escaped when converted to markup.
+type Text string
+
+// Group is a sequence of nodes.
+type Group []Node
+
+// Weight is a font weight.
+type Weight string
+
+const (
+	Ultralight Weight = "ultralight"
+	Light      Weight = "light"
+	Normal     Weight = "normal"
+	Bold       Weight = "bold"
+	Ultrabold  Weight = "ultrabold"
+	Heavy      Weight = "heavy"
+)
+
+// Size is a font size.
+type Size string
+
+const (
+	XXSmall Size = "xx-small"
+	XSmall  Size = "x-small"
+	Small   Size = "small"
+	Medium  Size = "medium"
+	Large   Size = "large"
+	XLarge  Size = "x-large"
+	XXLarge Size = "xx-large"
+	Smaller Size = "smaller"
+	Larger  Size = "larger"
+)
+
+// Points returns an absolute font size.
+func Points(pt float64) Size {
+	return Size(strconv.Itoa(int(pt * 1024)))
+}
+
+// Span applies attributes to its content. Zero values are left unset.
+type Span struct {
+	Foreground uint32 // 0xRRGGBBAA
+	Background uint32 // ^
+	Weight     Weight
+	Size       Size
+	Font       string // font description (e.g., "Font Awesome 6 Free 10")
+	Rise       int    // vertical displacement in 1024ths of a point
+	Content    Node
+}
+
+// Escape escapes s for use in markup.
+func Escape(s string) string {
+	return string(appendEscaped(nil, s))
+}
+
+// Markup returns the markup for n.
+func Markup(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return string(n.appendMarkup(nil))
+}
+
+// Plain returns the plain text of n without any markup.
+func Plain(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return string(n.appendText(nil))
+}
+
+// Block sets the full text of b to the markup for n and enables pango. If
+// b.ShortText is empty, it is set to the plain text of n, otherwise it is
+// treated as plain text and escaped.
+func Block(b barproto.Block, n Node) barproto.Block {
+	if b.ShortText == "" {
+		b.ShortText = Plain(n)
+	}
+	b.ShortText = Escape(b.ShortText)
+	b.FullText = Markup(n)
+	b.Pango = true
+	return b
+}
+
+func (t Text) appendMarkup(b []byte) []byte {
+	return appendEscaped(b, string(t))
+}
+
+func (t Text) appendText(b []byte) []byte {
+	return append(b, t...)
+}
+
+func (g Group) appendMarkup(b []byte) []byte {
+	for _, n := range g {
+		if n != nil {
+			b = n.appendMarkup(b)
+		}
+	}
+	return b
+}
+
+func (g Group) appendText(b []byte) []byte {
+	for _, n := range g {
+		if n != nil {
+			b = n.appendText(b)
+		}
+	}
+	return b
+}
+
+func (s Span) appendMarkup(b []byte) []byte {
+	b = append(b, "<span"...)
+	if s.Foreground != 0 {
+		b = appendColor(b, "foreground", "fgalpha", s.Foreground)
+	}
+	if s.Background != 0 {
+		b = appendColor(b, "background", "bgalpha", s.Background)
+	}
+	if s.Weight != "" {
+		b = appendAttr(b, "weight", string(s.Weight))
+	}
+	if s.Size != "" {
+		b = appendAttr(b, "size", string(s.Size))
+	}
+	if s.Font != "" {
+		b = appendAttr(b, "font", s.Font)
+	}
+	if s.Rise != 0 {
+		b = appendAttr(b, "rise", strconv.Itoa(s.Rise))
+	}
+	b = append(b, '>')
+	if s.Content != nil {
+		b = s.Content.appendMarkup(b)
+	}
+	b = append(b, "</span>"...)
+	return b
+}
+
+func (s Span) appendText(b []byte) []byte {
+	if s.Content != nil {
+		b = s.Content.appendText(b)
+	}
+	return b
+}
+
+func appendAttr(b []byte, name, value string) []byte {
+	b = append(b, ' ')
+	b = append(b, name...)
+	b = append(b, `="`...)
+	b = appendEscaped(b, value)
+	b = append(b, '"')
+	return b
+}
+
+func appendColor(b []byte, name, alpha string, rrggbbaa uint32) []byte {
+	const hex = "0123456789ABCDEF"
+	b = append(b, ' ')
+	b = append(b, name...)
+	b = append(b, `="#`...)
+	for i := 7; i >= 2; i-- {
+		b = append(b, hex[rrggbbaa>>(i*4)&0xF])
+	}
+	b = append(b, '"')
+	if a := rrggbbaa & 0xFF; a != 0xFF {
+		b = append(b, ' ')
+		b = append(b, alpha...)
+		b = append(b, `="`...)
+		b = strconv.AppendUint(b, uint64(a)*100/0xFF, 10)
+		b = append(b, `%"`...)
+	}
+	return b
+}
+
+// appendEscaped escapes s like g_markup_escape_text, replacing invalid UTF-8
+// (which would cause the entire block to fail to parse).
+func appendEscaped(b []byte, s string) []byte {
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+	x := 0
+	for i := 0; i < len(s); i++ {
+		var r string
+		switch c := s[i]; c {
+		case '&':
+			r = "&amp;"
+		case '<':
+			r = "&lt;"
+		case '>':
+			r = "&gt;"
+		case '\'':
+			r = "&#39;"
+		case '"':
+			r = "&quot;"
+		case '\t', '\n', '\r':
+			continue
+		default:
+			if c >= 0x20 && c != 0x7F {
+				continue
+			}
+			r = "&#x" + strconv.FormatUint(uint64(c), 16) + ";"
+		}
+		b = append(b, s[x:i]...)
+		b = append(b, r...)
+		x = i + 1
+	}
+	return append(b, s[x:]...)
+}
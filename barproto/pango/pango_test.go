@@ -0,0 +1,53 @@
+package pango
+
+import (
+	"testing"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestEscape(t *testing.T) {
+	for in, exp := range map[string]string{
+		"":              "",
+		"plain":         "plain",
+		"a & b <c> 'd'": "a &amp; b &lt;c&gt; &#39;d&#39;",
+		`"q"`:           "&quot;q&quot;",
+		"x\x01\ty\n":    "x&#x1;\ty\n",
+		"\xffé":         "�é",
+	} {
+		if act := Escape(in); act != exp {
+			t.Errorf("Escape(%q): expected %q, got %q", in, exp, act)
+		}
+	}
+}
+
+func TestMarkup(t *testing.T) {
+	n := Group{
+		Text("Tom & Jerry - "),
+		Span{
+			Foreground: 0xFF000080,
+			Weight:     Bold,
+			Size:       Points(10),
+			Content: Group{
+				Text("<title>"),
+				Span{Font: `Font "Awesome"`, Rise: -1024, Content: Text("")},
+			},
+		},
+		nil,
+		Span{},
+	}
+	if act, exp := Markup(n), `Tom &amp; Jerry - <span foreground="#FF0000" fgalpha="50%" weight="bold" size="10240">&lt;title&gt;<span font="Font &quot;Awesome&quot;" rise="-1024">`+""+`</span></span><span></span>`; act != exp {
+		t.Errorf("Markup: expected %q, got %q", exp, act)
+	}
+	if act, exp := Plain(n), "Tom & Jerry - <title>"; act != exp {
+		t.Errorf("Plain: expected %q, got %q", exp, act)
+	}
+
+	b := Block(barproto.Block{Instance: "x"}, n)
+	if !b.Pango || b.Instance != "x" || b.FullText != Markup(n) || b.ShortText != Escape(Plain(n)) {
+		t.Errorf("incorrect block %+v", b)
+	}
+	if b := Block(barproto.Block{ShortText: "a&b"}, Text("c")); b.ShortText != "a&amp;b" || b.FullText != "c" {
+		t.Errorf("incorrect block %+v", b)
+	}
+}
@@ -0,0 +1,204 @@
+package barproto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/tidwall/gjson"
+)
+
+// Decoder reads the status line protocol written by an i3bar producer: a
+// header, followed by an infinite array of status lines.
+type Decoder struct {
+	r      *bufio.Reader
+	buf    []byte
+	header bool
+	array  bool // the array was opened
+	line   bool // a status line was read
+}
+
+// NewDecoder returns a new decoder reading from r. It may read more data than
+// necessary from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Header reads the header. It must be called once before Next.
+func (d *Decoder) Header() (Init, error) {
+	var init Init
+	if d.header {
+		return init, fmt.Errorf("header already read")
+	}
+	c, err := d.skip()
+	if err != nil {
+		return init, err
+	}
+	if c != '{' {
+		return init, fmt.Errorf("decode i3bar header: expected object, got %q", c)
+	}
+	if err := d.value(c); err != nil {
+		return init, fmt.Errorf("decode i3bar header: %w", err)
+	}
+	if err := init.UnmarshalJSON(d.buf); err != nil {
+		return init, err
+	}
+	d.header = true
+	return init, nil
+}
+
+// Next reads the next status line. If the array is closed or the input ends
+// between status lines, io.EOF is returned.
+func (d *Decoder) Next() ([]Block, error) {
+	if !d.header {
+		return nil, fmt.Errorf("header not read")
+	}
+	c, err := d.skip()
+	if err != nil {
+		return nil, err
+	}
+	if !d.array {
+		if c != '[' {
+			return nil, fmt.Errorf("decode status line: expected array, got %q", c)
+		}
+		d.array = true
+		if c, err = d.skip(); err != nil {
+			return nil, err
+		}
+	}
+	if c == ']' {
+		return nil, io.EOF
+	}
+	if d.line {
+		if c != ',' {
+			return nil, fmt.Errorf("decode status line: expected comma, got %q", c)
+		}
+		if c, err = d.skip(); err != nil {
+			return nil, err
+		}
+	}
+	if c != '[' {
+		return nil, fmt.Errorf("decode status line: expected array, got %q", c)
+	}
+	if err := d.value(c); err != nil {
+		return nil, fmt.Errorf("decode status line: %w", err)
+	}
+	if !gjson.ValidBytes(d.buf) {
+		return nil, fmt.Errorf("decode status line: invalid json")
+	}
+	blocks := []Block{}
+	gjson.ParseBytes(d.buf).ForEach(func(_, value gjson.Result) bool {
+		var block Block
+		if err = block.UnmarshalJSON([]byte(value.Raw)); err != nil {
+			return false
+		}
+		blocks = append(blocks, block)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.line = true
+	return blocks, nil
+}
+
+// skip reads the next non-whitespace byte.
+func (d *Decoder) skip() (byte, error) {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err // io.EOF if there's no more input
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+}
+
+// value reads the remainder of the object or array starting with c into buf.
+// The contents are validated separately.
+func (d *Decoder) value(c byte) error {
+	d.buf = append(d.buf[:0], c)
+	var (
+		depth  = 1
+		str    bool
+		escape bool
+	)
+	for depth != 0 {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		d.buf = append(d.buf, c)
+		switch {
+		case escape:
+			escape = false
+		case str:
+			switch c {
+			case '\\':
+				escape = true
+			case '"':
+				str = false
+			}
+		default:
+			switch c {
+			case '"':
+				str = true
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+			}
+		}
+	}
+	return nil
+}
+
+// Encoder writes the status line protocol in the same format as i3status.
+type Encoder struct {
+	w      io.Writer
+	buf    []byte
+	header bool
+}
+
+// NewEncoder returns a new encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Header writes the header and starts the array. It must be called once
+// before Encode.
+func (e *Encoder) Header(init Init) error {
+	if e.header {
+		return fmt.Errorf("header already written")
+	}
+	e.buf = init.AppendJSON(e.buf[:0])
+	e.buf = append(e.buf, "\n[[]\n"...)
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	e.header = true
+	return nil
+}
+
+// Encode writes a status line.
+func (e *Encoder) Encode(blocks []Block) error {
+	if !e.header {
+		return fmt.Errorf("header not written")
+	}
+	e.buf = append(e.buf[:0], ",["...)
+	for i, block := range blocks {
+		if i != 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.buf = block.AppendJSON(e.buf)
+	}
+	e.buf = append(e.buf, "]\n"...)
+	_, err := e.w.Write(e.buf)
+	return err
+}
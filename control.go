@@ -0,0 +1,241 @@
+package barlib
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// The control socket accepts a single command line per connection, writes the
+// response, then closes the connection. If the command fails, the last line
+// of the response starts with "error: ". The commands are:
+//
+//	list                        list instances as "name\ttype" lines
+//	event <target> <json>       send an i3bar click event to the target
+//	action <target> <action>    send a named action to the target
+//	redraw                      redraw the bar
+//
+// A target is an instance name, a module type name (e.g., main.Backlight), or
+// a module type name without the package (e.g., Backlight), in which case all
+// matching instances are targeted.
+
+// DefaultControlSocket returns the default control socket path for the
+// current process. The barlibctl command sends commands to all sockets matching
+// ControlSocketGlob by default.
+func DefaultControlSocket() string {
+	return filepath.Join(controlSocketDir(), "barlib."+strconv.Itoa(os.Getpid())+".sock")
+}
+
+// ControlSocketGlob returns a glob matching all default control sockets for
+// the current user.
+func ControlSocketGlob() string {
+	return filepath.Join(controlSocketDir(), "barlib.*.sock")
+}
+
+// controlSocketDir returns the directory for sockets and other runtime files,
+// which is $XDG_RUNTIME_DIR, or a private directory for the current user in
+// the temporary directory if it isn't set.
+func controlSocketDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return tempSocketDir()
+}
+
+// tempSocketDir returns $TMPDIR/barlib-$UID, or a new private directory if it
+// can't be used (e.g., if another user created it first).
+var tempSocketDir = sync.OnceValue(func() string {
+	dir := filepath.Join(os.TempDir(), "barlib-"+strconv.Itoa(os.Getuid()))
+	if err := privateDir(dir, os.Getuid()); err == nil {
+		return dir
+	}
+	if dir, err := os.MkdirTemp("", "barlib-"); err == nil {
+		return dir
+	}
+	return dir // later operations will fail
+})
+
+// privateDir creates dir if it doesn't exist, and ensures it is a directory
+// only accessible by uid.
+func privateDir(dir string, uid int) error {
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != uid {
+		return fmt.Errorf("%q is not owned by uid %d", dir, uid)
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%q is accessible by other users (mode %s)", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// ControlCommand sends a command to the control socket at path, returning the
+// response lines. If the command fails, an error is returned.
+func ControlCommand(ctx context.Context, path string, args ...string) ([]string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, strings.Join(args, " ")+"\n"); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		if msg, ok := strings.CutPrefix(sc.Text(), "error: "); ok {
+			return lines, errors.New(msg)
+		}
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+func serveControl(ctx context.Context, path string, logger *slog.Logger, b *bar) error {
+	// remove stale sockets (e.g., if we were restarted or killed)
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %q is already in use", path)
+	} else if errors.Is(err, syscall.ECONNREFUSED) {
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close() // also removes the socket
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("failed to accept connection", "error", err)
+				}
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+				r := bufio.NewReader(conn)
+				line, err := r.ReadString('\n')
+				if err != nil {
+					logger.Warn("failed to read command", "error", err)
+					return
+				}
+
+				if cmd, args, _ := strings.Cut(strings.TrimSpace(line), " "); cmd == "stream" {
+					conn.SetDeadline(time.Time{})
+					if err := serveStream(ctx, conn, r, b, strings.Fields(args)); err != nil {
+						logger.Debug("stream failed", "error", err)
+					}
+					return
+				}
+
+				w := bufio.NewWriter(conn)
+				defer w.Flush()
+
+				if err := controlCommand(w, strings.TrimSpace(line), b.instances, b.invalidate); err != nil {
+					logger.Debug("command failed", "command", line, "error", err)
+					fmt.Fprintf(w, "error: %v\n", err)
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+func controlCommand(w io.Writer, line string, instances []*instanceImpl, invalidate func(now bool)) error {
+	cmd, line, _ := strings.Cut(line, " ")
+	switch cmd {
+	case "list":
+		for _, instance := range instances {
+			fmt.Fprintf(w, "%s\t%s\n", instance.name, instance.typ)
+		}
+		return nil
+	case "event":
+		target, arg, _ := strings.Cut(line, " ")
+		var event barproto.Event
+		if err := event.UnmarshalJSON([]byte(strings.TrimSpace(arg))); err != nil {
+			return err
+		}
+		return controlTarget(instances, target, func(instance *instanceImpl) {
+			event.Name = instance.name
+			instance.SendEvent(event)
+		})
+	case "action":
+		target, arg, _ := strings.Cut(line, " ")
+		if arg = strings.TrimSpace(arg); arg == "" {
+			return fmt.Errorf("no action specified")
+		}
+		return controlTarget(instances, target, func(instance *instanceImpl) {
+			instance.SendAction(arg)
+		})
+	case "redraw":
+		invalidate(true)
+		return nil
+	case "":
+		return fmt.Errorf("no command specified")
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func matchTarget(name, typ, target string) bool {
+	if target == name || target == typ {
+		return true
+	}
+	if i := strings.LastIndexByte(typ, '.'); i != -1 {
+		return target == typ[i+1:]
+	}
+	return false
+}
+
+func controlTarget(instances []*instanceImpl, target string, fn func(*instanceImpl)) error {
+	if target == "" {
+		return fmt.Errorf("no target specified")
+	}
+	var n int
+	for _, instance := range instances {
+		if matchTarget(instance.name, instance.typ, target) {
+			fn(instance)
+			n++
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("no instances match %q", target)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package barlib
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestControl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	actionCh := make(chan string, 1)
+	eventCh := make(chan string, 1)
+
+	sock := filepath.Join(t.TempDir(), "barlib.sock")
+	go Run(ctx, Options{
+		Stdout:        io.Discard,
+		TickRate:      time.Second,
+		ControlSocket: sock,
+	}, ModuleFunc(func(i Instance) error {
+		for {
+			select {
+			case action := <-i.Action():
+				actionCh <- action
+			case event := <-i.Event():
+				eventCh <- event.Instance
+			}
+		}
+	}))
+
+	var (
+		lines []string
+		err   error
+	)
+	for range 100 {
+		if lines, err = ControlCommand(ctx, sock, "list"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if exp := []string{"0\tbarlib.ModuleFunc"}; !reflect.DeepEqual(lines, exp) {
+		t.Errorf("list: expected %q, got %q", exp, lines)
+	}
+
+	if _, err := ControlCommand(ctx, sock, "action", "ModuleFunc", "test"); err != nil {
+		t.Errorf("action: %v", err)
+	} else if action := <-actionCh; action != "test" {
+		t.Errorf("action: expected %q, got %q", "test", action)
+	}
+
+	if _, err := ControlCommand(ctx, sock, "event", "0", `{"instance":"block","button":1}`); err != nil {
+		t.Errorf("event: %v", err)
+	} else if instance := <-eventCh; instance != "block" {
+		t.Errorf("event: expected %q, got %q", "block", instance)
+	}
+
+	if _, err := ControlCommand(ctx, sock, "redraw"); err != nil {
+		t.Errorf("redraw: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"action", "1", "test"},
+		{"action", "0"},
+		{"event", "0", "invalid"},
+		{"invalid"},
+	} {
+		if _, err := ControlCommand(ctx, sock, args...); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestControlUnavailable(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "nonexistent", "barlib.sock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := Run(ctx, Options{
+		Stdout:        io.Discard,
+		TickRate:      time.Second,
+		ControlSocket: sock,
+	}); err != nil {
+		t.Errorf("expected bar to run without the control socket, got %v", err)
+	}
+
+	if err := Run(context.Background(), Options{
+		TickRate:      time.Second,
+		ControlSocket: sock,
+	}); err == nil {
+		t.Errorf("expected error for daemon without a control socket")
+	}
+}
+
+func TestPrivateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "barlib")
+	if err := privateDir(dir, os.Getuid()); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := privateDir(dir, os.Getuid()); err != nil {
+		t.Errorf("existing: %v", err)
+	}
+	if err := privateDir(dir, os.Getuid()+1); err == nil {
+		t.Errorf("expected error for directory owned by another user")
+	}
+	os.Chmod(dir, 0o777)
+	if err := privateDir(dir, os.Getuid()); err == nil {
+		t.Errorf("expected error for world-writable directory")
+	}
+	os.Chmod(dir, 0o700)
+	link := filepath.Join(t.TempDir(), "link")
+	os.Symlink(dir, link)
+	if err := privateDir(link, os.Getuid()); err == nil {
+		t.Errorf("expected error for symlink")
+	}
+}
@@ -0,0 +1,415 @@
+package barlib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// A bar can be shared between multiple i3bar/swaybar instances by running it
+// as a daemon (without stdout) with a control socket, and using [Attach] (or
+// "barlibctl attach") as the status command for each bar. The stream command
+// on the control socket turns the connection into a status line stream for the
+// selected modules:
+//
+//	stream [target...]          stream i3bar status lines for the targets
+//
+// After the command, the client sends i3bar click event lines, or "stop" and
+// "cont" lines when the bar is hidden or shown. A module is stopped when all
+// bars showing it are stopped. The client may also send a "bar name" line with
+// the [barproto.Bar] it is attached to, in which case modules only use the
+// capabilities supported by all bars showing them, and are notified to
+// re-render when those change.
+
+// DefaultDaemonSocket returns the default control socket path for a bar
+// running as a daemon. It matches [ControlSocketGlob].
+func DefaultDaemonSocket() string {
+	return filepath.Join(controlSocketDir(), "barlib.daemon.sock")
+}
+
+// viewer is a status bar showing a subset of the instances.
+type viewer struct {
+	instances []*instanceImpl
+	stopped   bool
+	bar       barproto.Bar
+	notify    chan struct{} // nil if rendered directly
+}
+
+// addViewer registers a new viewer for instances on the specified bar, which
+// will be notified after the bar is rendered if notify is true.
+func (b *bar) addViewer(instances []*instanceImpl, bar barproto.Bar, notify bool) *viewer {
+	v := &viewer{instances: instances, bar: bar}
+	if notify {
+		v.notify = make(chan struct{}, 1)
+		v.notify <- struct{}{}
+	}
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	b.viewers[v] = struct{}{}
+	b.updateStopped()
+	b.updateCapabilities()
+	return v
+}
+
+// removeViewer unregisters v.
+func (b *bar) removeViewer(v *viewer) {
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	delete(b.viewers, v)
+	b.updateStopped()
+	b.updateCapabilities()
+}
+
+// setStopped sets the stopped state of v.
+func (b *bar) setStopped(v *viewer, stopped bool) {
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	v.stopped = stopped
+	b.updateStopped()
+}
+
+// setBar sets the bar v is shown on.
+func (b *bar) setBar(v *viewer, bar barproto.Bar) {
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	v.bar = bar
+	b.updateCapabilities()
+}
+
+// capabilities returns the capabilities supported by all viewers showing
+// instance.
+func (b *bar) capabilities(instance *instanceImpl) barproto.Capabilities {
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	caps, _ := b.capabilitiesLocked(instance, false)
+	return caps
+}
+
+// themeLocked returns the theme adjusted for the viewers showing instance. Only
+// viewers on a detected bar are considered, so the theme is unchanged if the
+// bar is unknown. The viewers lock must be held.
+func (b *bar) themeLocked(instance *instanceImpl) Theme {
+	if caps, ok := b.capabilitiesLocked(instance, true); ok {
+		return b.theme.For(caps)
+	}
+	return b.theme
+}
+
+// capabilitiesLocked is like capabilities, but the viewers lock must be held.
+// If detected is true, viewers on an unknown bar are ignored. If no viewers
+// were considered, ok is false.
+func (b *bar) capabilitiesLocked(instance *instanceImpl, detected bool) (caps barproto.Capabilities, ok bool) {
+	for v := range b.viewers {
+		if detected && v.bar == barproto.UnknownBar {
+			continue
+		}
+		if slices.Contains(v.instances, instance) {
+			if ok {
+				caps = caps.And(v.bar.Capabilities())
+			} else {
+				caps, ok = v.bar.Capabilities(), true
+			}
+		}
+	}
+	return caps, ok
+}
+
+// updateStopped stops instances which aren't shown by any running viewer. The
+// viewers lock must be held.
+func (b *bar) updateStopped() {
+	for _, instance := range b.instances {
+		stopped := true
+		for v := range b.viewers {
+			if !v.stopped && slices.Contains(v.instances, instance) {
+				stopped = false
+				break
+			}
+		}
+		if instance.stopped.Load() != stopped {
+			instance.SendStopped(stopped)
+		}
+	}
+}
+
+// updateCapabilities notifies instances whose capabilities changed so they can
+// re-render. The viewers lock must be held.
+func (b *bar) updateCapabilities() {
+	for _, instance := range b.instances {
+		caps, _ := b.capabilitiesLocked(instance, false)
+		theme := b.themeLocked(instance)
+		if instance.caps != caps || instance.theme != theme {
+			instance.caps, instance.theme = caps, theme
+			instance.SendCapabilitiesChanged()
+		}
+	}
+}
+
+// rendered notifies viewers that the bar was rendered.
+func (b *bar) rendered() {
+	b.viewersMu.Lock()
+	defer b.viewersMu.Unlock()
+	for v := range b.viewers {
+		if v.notify != nil {
+			select {
+			case v.notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// serveStream streams status lines for the targets to conn, reading events and
+// stop/cont lines from r.
+func serveStream(ctx context.Context, conn net.Conn, r *bufio.Reader, b *bar, targets []string) error {
+	instances := b.instances
+	if len(targets) != 0 {
+		instances = nil
+		for _, target := range targets {
+			if err := controlTarget(b.instances, target, func(instance *instanceImpl) {
+				if !slices.Contains(instances, instance) {
+					instances = append(instances, instance)
+				}
+			}); err != nil {
+				fmt.Fprintf(conn, "error: %v\n", err)
+				return err
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	v := b.addViewer(instances, barproto.UnknownBar, true)
+	defer b.removeViewer(v)
+
+	go func() {
+		defer cancel()
+		for {
+			buf, err := r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			line := strings.TrimSpace(string(buf))
+			if name, ok := strings.CutPrefix(line, "bar "); ok {
+				b.setBar(v, barproto.Bar(name))
+				continue
+			}
+			switch line {
+			case "stop":
+				b.setStopped(v, true)
+			case "cont":
+				b.setStopped(v, false)
+			default:
+				event, ok, err := I3barOutput{}.ParseEvent([]byte(line))
+				if err != nil {
+					b.logger.Warn("invalid event line", "component", "stream", "line", line, "error", err)
+					continue
+				}
+				if ok {
+					for _, instance := range instances {
+						instance.SendEvent(event)
+					}
+				}
+			}
+		}
+	}()
+
+	var (
+		buf    []byte
+		last   []byte
+		blocks []barproto.Block
+	)
+	for {
+		select {
+		case <-v.notify:
+		case <-ctx.Done():
+			return nil
+		}
+		blocks = blocks[:0]
+		for _, instance := range instances {
+			blocks = instance.AppendTo(blocks)
+		}
+		buf = I3barOutput{}.AppendStatus(buf[:0], blocks)
+		if bytes.Equal(buf, last) {
+			continue // other instances changed
+		}
+		if _, err := conn.Write(buf); err != nil {
+			return err
+		}
+		buf, last = last, buf
+	}
+}
+
+// Attach connects to a bar running as a daemon with a control socket at path,
+// writing the status lines for the modules selected by [Options.Select] to
+// stdout, and forwarding events from stdin, until ctx is cancelled or stdin is
+// closed, in which case it returns nil. If the daemon restarts, Attach
+// reconnects to it.
+//
+// Only Stdin, Stdout, StopSignal, ContSignal, Select, Bar, and Logger are used
+// from opt.
+func Attach(ctx context.Context, path string, opt Options) error {
+	if opt.Stdout == nil {
+		return fmt.Errorf("no stdout provided")
+	}
+	if opt.Logger == nil {
+		opt.Logger = slog.Default()
+	}
+	if opt.Bar == barproto.UnknownBar {
+		opt.Bar = barproto.DetectBar()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		mu      sync.Mutex
+		conn    net.Conn
+		stopped bool
+	)
+	send := func(line []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		if conn != nil {
+			conn.Write(line)
+		}
+	}
+
+	if opt.Stdin != nil {
+		go func() {
+			sc := bufio.NewScanner(opt.Stdin)
+			for sc.Scan() {
+				send(append(sc.Bytes(), '\n'))
+			}
+			if err := sc.Err(); err != nil {
+				cancel(fmt.Errorf("read stdin: %w", err))
+			} else {
+				cancel(io.EOF)
+			}
+		}()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	for _, sig := range []syscall.Signal{opt.StopSignal, opt.ContSignal} {
+		if sig != 0 {
+			signal.Notify(sigCh, sig)
+		}
+	}
+	defer signal.Stop(sigCh)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				mu.Lock()
+				stopped = sig == opt.StopSignal
+				mu.Unlock()
+				if stopped {
+					send([]byte("stop\n"))
+				} else {
+					send([]byte("cont\n"))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if _, err := opt.Stdout.Write(I3barOutput{}.AppendHeader(nil, barproto.Init{
+		StopSignal:  opt.StopSignal,
+		ContSignal:  opt.ContSignal,
+		ClickEvents: opt.Stdin != nil,
+	})); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	for connected := false; ; {
+		var received bool
+		err := func() error {
+			var d net.Dialer
+			c, err := d.DialContext(ctx, "unix", path)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			go func() {
+				<-ctx.Done()
+				c.Close()
+			}()
+
+			mu.Lock()
+			conn = c
+			line := "stream " + strings.Join(opt.Select, " ") + "\n"
+			if opt.Bar != barproto.UnknownBar {
+				line += "bar " + string(opt.Bar) + "\n"
+			}
+			if stopped {
+				line += "stop\n"
+			}
+			_, err = io.WriteString(c, line)
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				mu.Lock()
+				conn = nil
+				mu.Unlock()
+			}()
+
+			sc := bufio.NewScanner(c)
+			for sc.Scan() {
+				if msg, ok := strings.CutPrefix(sc.Text(), "error: "); ok {
+					return &attachError{errors.New(msg)}
+				}
+				connected, received = true, true
+				if _, err := opt.Stdout.Write(append(sc.Bytes(), '\n')); err != nil {
+					return &attachError{fmt.Errorf("write status line: %w", err)}
+				}
+			}
+			return sc.Err()
+		}()
+		if ctx.Err() != nil {
+			return runErr(ctx)
+		}
+		if ae, ok := err.(*attachError); ok {
+			return ae.err
+		}
+		if !connected {
+			return fmt.Errorf("connect to %q: %w", path, err)
+		}
+		if received {
+			opt.Logger.Warn("disconnected from daemon, reconnecting", "error", err)
+		} else {
+			opt.Logger.Debug("failed to reconnect to daemon", "error", err)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return runErr(ctx)
+		}
+	}
+}
+
+// attachError is a fatal error while attached to a daemon.
+type attachError struct {
+	err error
+}
+
+func (e *attachError) Error() string {
+	return e.err.Error()
+}
@@ -0,0 +1,146 @@
+package barlib
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestAttach(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	module := ModuleFunc(func(i Instance) error {
+		text := "init"
+		for {
+			i.Update(true, func(render Renderer) {
+				render(barproto.Block{
+					Instance: "text",
+					FullText: text + " " + strconv.FormatBool(i.IsStopped()),
+				})
+			})
+			select {
+			case event := <-i.Event():
+				text = event.Instance
+			case <-i.Stopped():
+			case <-i.Context().Done():
+				return nil
+			}
+		}
+	})
+
+	sock := filepath.Join(t.TempDir(), "barlib.sock")
+	go Run(ctx, Options{
+		TickRate:      time.Second,
+		ControlSocket: sock,
+	}, module, module)
+
+	var err error
+	for range 100 {
+		if _, err = ControlCommand(ctx, sock, "list"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	go func() {
+		stdoutW.CloseWithError(Attach(ctx, sock, Options{
+			Stdin:  stdinR,
+			Stdout: stdoutW,
+			Select: []string{"1"},
+		}))
+	}()
+
+	sc := bufio.NewScanner(stdoutR)
+	expect := func(line string) {
+		t.Helper()
+		for sc.Scan() {
+			if sc.Text() == line {
+				return
+			}
+			t.Logf("skipping line %q", sc.Text())
+		}
+		t.Fatalf("expected line %q, got error %v", line, sc.Err())
+	}
+	expect(`{"version":1,"click_events":true}`)
+	expect(`[[]`)
+	expect(`,[{"full_text":"init false","name":"1","instance":"text","separator":false,"separator_block_width":0}]`)
+
+	io.WriteString(stdinW, "[\n")
+	io.WriteString(stdinW, `{"name":"0","instance":"wrong","button":1}`+"\n")
+	io.WriteString(stdinW, `,{"name":"1","instance":"clicked","button":1}`+"\n")
+	expect(`,[{"full_text":"clicked false","name":"1","instance":"text","separator":false,"separator_block_width":0}]`)
+
+	if conn, err := net.Dial("unix", sock); err != nil {
+		t.Errorf("stream: %v", err)
+	} else {
+		io.WriteString(conn, "stream 0\n")
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+			t.Errorf("stream: %v", err)
+		} else if exp := `,[{"full_text":"init true","name":"0","instance":"text","separator":false,"separator_block_width":0}]` + "\n"; line != exp {
+			t.Errorf("stream: expected %q, got %q", exp, line)
+		}
+		conn.Close()
+	}
+
+	stdinW.Close()
+	if sc.Scan() {
+		t.Errorf("unexpected line %q", sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Errorf("attach: %v", err)
+	}
+}
+
+func TestViewerCapabilities(t *testing.T) {
+	var (
+		x = &instanceImpl{capsCh: make(chan struct{}, 1)}
+		y = &instanceImpl{capsCh: make(chan struct{}, 1)}
+		b = &bar{viewers: make(map[*viewer]struct{}), instances: []*instanceImpl{x, y}}
+	)
+	check := func(instance *instanceImpl, exp barproto.Capabilities, changed bool) {
+		t.Helper()
+		if act := b.capabilities(instance); act != exp {
+			t.Errorf("expected %+v, got %+v", exp, act)
+		}
+		select {
+		case <-instance.CapabilitiesChanged():
+			if !changed {
+				t.Errorf("unexpected change notification")
+			}
+		default:
+			if changed {
+				t.Errorf("expected change notification")
+			}
+		}
+	}
+	check(x, barproto.Capabilities{}, false)
+
+	b.addViewer([]*instanceImpl{x, y}, barproto.Swaybar, true)
+	check(x, barproto.Swaybar.Capabilities(), true)
+	check(y, barproto.Swaybar.Capabilities(), true)
+
+	v := b.addViewer([]*instanceImpl{y}, barproto.UnknownBar, true)
+	b.setBar(v, barproto.I3barRiver)
+	check(x, barproto.Swaybar.Capabilities(), false)
+	check(y, barproto.Capabilities{BlockColors: true}, true)
+
+	b.setBar(v, barproto.I3barRiver)
+	check(y, barproto.Capabilities{BlockColors: true}, false)
+
+	b.removeViewer(v)
+	check(x, barproto.Swaybar.Capabilities(), false)
+	check(y, barproto.Swaybar.Capabilities(), true)
+}
@@ -0,0 +1,317 @@
+// Package dbusutil provides helpers for modules which watch DBus services.
+package dbusutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Bus is a reference-counted connection to a message bus.
+type Bus struct {
+	conn *dbus.Conn
+	refs int // protected by busMu
+}
+
+var (
+	busMu      sync.Mutex
+	sessionBus *Bus
+	systemBus  *Bus
+)
+
+// SessionBus acquires a reference to the shared session bus connection,
+// connecting if there isn't one or the previous one was disconnected. Release
+// must be called when done.
+func SessionBus() (*Bus, error) {
+	return acquire(&sessionBus, dbus.ConnectSessionBus)
+}
+
+// SystemBus is like SessionBus, but for the system bus.
+func SystemBus() (*Bus, error) {
+	return acquire(&systemBus, dbus.ConnectSystemBus)
+}
+
+func acquire(b **Bus, connect func(...dbus.ConnOption) (*dbus.Conn, error)) (*Bus, error) {
+	busMu.Lock()
+	defer busMu.Unlock()
+
+	if *b == nil || !(*b).conn.Connected() {
+		conn, err := connect()
+		if err != nil {
+			return nil, err
+		}
+		*b = &Bus{conn: conn}
+	}
+	(*b).refs++
+	return *b, nil
+}
+
+// NewBus wraps an existing authenticated connection with a single reference,
+// which is closed when released.
+func NewBus(conn *dbus.Conn) *Bus {
+	return &Bus{conn: conn, refs: 1}
+}
+
+// Conn returns the underlying connection, which must not be closed directly.
+func (b *Bus) Conn() *dbus.Conn {
+	return b.conn
+}
+
+// Release releases a reference to the connection, closing it if it was the
+// last one.
+func (b *Bus) Release() {
+	busMu.Lock()
+	defer busMu.Unlock()
+
+	if b.refs--; b.refs < 0 {
+		panic("dbusutil: bus released too many times")
+	} else if b.refs == 0 {
+		b.conn.Close()
+		if sessionBus == b {
+			sessionBus = nil
+		}
+		if systemBus == b {
+			systemBus = nil
+		}
+	}
+}
+
+// Match is a signal match rule. Empty fields match anything.
+type Match struct {
+	Sender    string // unique or well-known name
+	Path      dbus.ObjectPath
+	Interface string
+	Member    string
+	Arg0      string
+}
+
+func (m Match) options() []dbus.MatchOption {
+	var opts []dbus.MatchOption
+	if m.Sender != "" {
+		opts = append(opts, dbus.WithMatchSender(m.Sender))
+	}
+	if m.Path != "" {
+		opts = append(opts, dbus.WithMatchObjectPath(m.Path))
+	}
+	if m.Interface != "" {
+		opts = append(opts, dbus.WithMatchInterface(m.Interface))
+	}
+	if m.Member != "" {
+		opts = append(opts, dbus.WithMatchMember(m.Member))
+	}
+	if m.Arg0 != "" {
+		opts = append(opts, dbus.WithMatchArg(0, m.Arg0))
+	}
+	return opts
+}
+
+// Matches checks whether the signal matches the rule. Since signals are sent
+// from the unique name of the owner, well-known sender names other than the
+// bus itself are not checked.
+func (m Match) Matches(sig *dbus.Signal) bool {
+	if m.Sender != "" && (strings.HasPrefix(m.Sender, ":") || m.Sender == "org.freedesktop.DBus") && sig.Sender != m.Sender {
+		return false
+	}
+	if m.Path != "" && sig.Path != m.Path {
+		return false
+	}
+	if m.Interface != "" || m.Member != "" {
+		iface, member := splitName(sig.Name)
+		if m.Interface != "" && iface != m.Interface {
+			return false
+		}
+		if m.Member != "" && member != m.Member {
+			return false
+		}
+	}
+	if m.Arg0 != "" {
+		if len(sig.Body) == 0 {
+			return false
+		}
+		if v, _ := sig.Body[0].(string); v != m.Arg0 {
+			return false
+		}
+	}
+	return true
+}
+
+func splitName(name string) (iface, member string) {
+	if i := strings.LastIndexByte(name, '.'); i != -1 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// Subscription receives signals matching a rule. Since the connection is
+// shared, signals are also filtered on the client.
+type Subscription struct {
+	C <-chan *dbus.Signal
+
+	bus   *Bus
+	match Match
+	raw   chan *dbus.Signal
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// Subscribe adds a match rule and returns a subscription for matching signals.
+// It must be closed when done.
+func (b *Bus) Subscribe(m Match) (*Subscription, error) {
+	if err := b.conn.AddMatchSignal(m.options()...); err != nil {
+		return nil, fmt.Errorf("add match: %w", err)
+	}
+	var (
+		raw = make(chan *dbus.Signal, 16)
+		ch  = make(chan *dbus.Signal, 16)
+	)
+	s := &Subscription{
+		C:     ch,
+		bus:   b,
+		match: m,
+		raw:   raw,
+		done:  make(chan struct{}),
+	}
+	b.conn.Signal(raw)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case sig, ok := <-raw:
+				if !ok {
+					return
+				}
+				if s.match.Matches(sig) {
+					select {
+					case ch <- sig:
+					case <-s.done:
+						return
+					}
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Close removes the match rule and stops receiving signals.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.bus.conn.RemoveSignal(s.raw)
+		s.bus.conn.RemoveMatchSignal(s.match.options()...)
+		s.wg.Wait()
+	})
+}
+
+// Service watches the owner of a well-known name.
+type Service struct {
+	name    string
+	sub     *Subscription
+	changed chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+
+	mu    sync.Mutex
+	owner string
+}
+
+// WatchService watches the owner of a well-known name. It must be closed when
+// done.
+func (b *Bus) WatchService(name string) (*Service, error) {
+	sub, err := b.Subscribe(Match{
+		Sender:    "org.freedesktop.DBus",
+		Path:      "/org/freedesktop/DBus",
+		Interface: "org.freedesktop.DBus",
+		Member:    "NameOwnerChanged",
+		Arg0:      name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		name:    name,
+		sub:     sub,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if err := b.conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&s.owner); err != nil {
+		if !isError(err, "org.freedesktop.DBus.Error.NameHasNoOwner") {
+			sub.Close()
+			return nil, fmt.Errorf("get owner of %q: %w", name, err)
+		}
+		s.owner = ""
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case sig := <-sub.C:
+				if len(sig.Body) != 3 {
+					continue
+				}
+				owner, _ := sig.Body[2].(string)
+				s.mu.Lock()
+				s.owner = owner
+				s.mu.Unlock()
+				notify(s.changed)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Name returns the watched name.
+func (s *Service) Name() string {
+	return s.name
+}
+
+// Owner returns the unique name of the current owner, or an empty string if
+// the service is not running.
+func (s *Service) Owner() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owner
+}
+
+// Changed returns a channel which is notified when the service appears or
+// disappears. The buffer size is 1.
+func (s *Service) Changed() <-chan struct{} {
+	return s.changed
+}
+
+// Close stops watching the service.
+func (s *Service) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.sub.Close()
+		s.wg.Wait()
+	})
+}
+
+func isError(err error, name string) bool {
+	if dErr := (dbus.Error{}); errors.As(err, &dErr) {
+		return dErr.Name == name
+	}
+	if dErr := (*dbus.Error)(nil); errors.As(err, &dErr) {
+		return dErr.Name == name
+	}
+	return false
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
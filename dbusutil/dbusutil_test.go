@@ -0,0 +1,174 @@
+package dbusutil
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+func testBus(t *testing.T) (client *Bus, service *dbus.Conn) {
+	t.Helper()
+
+	exe, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	cmd := exec.Command(exe, "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("start dbus-daemon: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read dbus-daemon address: %v", err)
+	}
+	addr = strings.TrimSpace(addr)
+
+	connect := func() *dbus.Conn {
+		conn, err := dbus.Connect(addr)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		return conn
+	}
+	client, service = NewBus(connect()), connect()
+	t.Cleanup(func() {
+		service.Close()
+	})
+	return client, service
+}
+
+func wait(t *testing.T, ch <-chan struct{}, what string, cond func() bool) {
+	t.Helper()
+	timeout := time.After(time.Second * 5)
+	for !cond() {
+		select {
+		case <-ch:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	const (
+		name  = "com.example.Test"
+		path  = "/com/example/Test"
+		iface = "com.example.Test"
+	)
+	bus, conn := testBus(t)
+	defer bus.Release()
+
+	p, err := bus.Properties(name, path, iface)
+	if err != nil {
+		t.Fatalf("watch properties: %v", err)
+	}
+	defer p.Close()
+
+	if p.Available() {
+		t.Errorf("expected properties to be unavailable before service starts")
+	}
+	if p.Err() == nil {
+		t.Errorf("expected error before service starts")
+	}
+
+	props, err := prop.Export(conn, path, prop.Map{
+		iface: {
+			"Value":       {Value: int32(1), Emit: prop.EmitTrue},
+			"Invalidated": {Value: "a", Emit: prop.EmitInvalidates},
+		},
+	})
+	if err != nil {
+		t.Fatalf("export properties: %v", err)
+	}
+	if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatalf("request name: %v", err)
+	}
+
+	wait(t, p.Changed(), "service to appear", p.Available)
+	if v, ok := Get[int32](p, "Value"); !ok || v != 1 {
+		t.Errorf("expected Value=1, got %d (ok=%t)", v, ok)
+	}
+	if v, ok := Get[string](p, "Invalidated"); !ok || v != "a" {
+		t.Errorf("expected Invalidated=a, got %q (ok=%t)", v, ok)
+	}
+	if _, ok := Get[int32](p, "Missing"); ok {
+		t.Errorf("expected missing property to fail")
+	}
+
+	props.SetMust(iface, "Value", int32(2))
+	wait(t, p.Changed(), "property change", func() bool {
+		v, _ := Get[int32](p, "Value")
+		return v == 2
+	})
+
+	props.SetMust(iface, "Invalidated", "b")
+	wait(t, p.Changed(), "property invalidation", func() bool {
+		v, _ := Get[string](p, "Invalidated")
+		return v == "b"
+	})
+
+	if _, err := conn.ReleaseName(name); err != nil {
+		t.Fatalf("release name: %v", err)
+	}
+	wait(t, p.Changed(), "service to disappear", func() bool {
+		return !p.Available()
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	bus, conn := testBus(t)
+	defer bus.Release()
+
+	sub, err := bus.Subscribe(Match{
+		Path:      "/com/example/Test",
+		Interface: "com.example.Test",
+		Member:    "Ping",
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	for _, x := range []struct {
+		path dbus.ObjectPath
+		name string
+	}{
+		{"/com/example/Other", "com.example.Test.Ping"},
+		{"/com/example/Test", "com.example.Test.Pong"},
+		{"/com/example/Test", "com.example.Test.Ping"},
+	} {
+		if err := conn.Emit(x.path, x.name, x.path); err != nil {
+			t.Fatalf("emit: %v", err)
+		}
+	}
+
+	select {
+	case sig := <-sub.C:
+		if sig.Path != "/com/example/Test" || sig.Name != "com.example.Test.Ping" {
+			t.Errorf("unexpected signal %s %s", sig.Path, sig.Name)
+		}
+		if sig.Sender != conn.Names()[0] {
+			t.Errorf("unexpected sender %s", sig.Sender)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for signal")
+	}
+	select {
+	case sig := <-sub.C:
+		t.Errorf("unexpected signal %s %s", sig.Path, sig.Name)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
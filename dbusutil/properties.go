@@ -0,0 +1,206 @@
+package dbusutil
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Properties is a cache of the properties of an object interface, which is
+// kept in sync using PropertiesChanged signals, and reloaded when the service
+// appears.
+type Properties struct {
+	obj     dbus.BusObject
+	iface   string
+	svc     *Service
+	sub     *Subscription
+	changed chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+
+	mu    sync.Mutex
+	props map[string]dbus.Variant // nil if not available
+	err   error
+}
+
+// Properties watches the properties of an object interface. It must be closed
+// when done.
+func (b *Bus) Properties(service string, path dbus.ObjectPath, iface string) (*Properties, error) {
+	svc, err := b.WatchService(service)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := b.Subscribe(Match{
+		Sender:    service,
+		Path:      path,
+		Interface: "org.freedesktop.DBus.Properties",
+		Member:    "PropertiesChanged",
+		Arg0:      iface,
+	})
+	if err != nil {
+		svc.Close()
+		return nil, err
+	}
+	p := &Properties{
+		obj:     b.conn.Object(service, path),
+		iface:   iface,
+		svc:     svc,
+		sub:     sub,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	p.reload()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-svc.Changed():
+				p.reload()
+			case sig := <-sub.C:
+				if owner := svc.Owner(); owner != "" && sig.Sender != owner {
+					continue
+				}
+				p.apply(sig)
+			case <-p.done:
+				return
+			}
+			notify(p.changed)
+		}
+	}()
+	return p, nil
+}
+
+// reload replaces the cache with the current properties.
+func (p *Properties) reload() {
+	var (
+		props map[string]dbus.Variant
+		err   error
+	)
+	if p.svc.Owner() == "" {
+		err = fmt.Errorf("service %s is not running", p.svc.Name())
+	} else if err = p.obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, p.iface).Store(&props); err != nil {
+		err = fmt.Errorf("get %s properties: %w", p.iface, err)
+		props = nil
+	} else if props == nil {
+		props = map[string]dbus.Variant{}
+	}
+	p.mu.Lock()
+	p.props, p.err = props, err
+	p.mu.Unlock()
+}
+
+// apply applies a PropertiesChanged signal.
+func (p *Properties) apply(sig *dbus.Signal) {
+	if len(sig.Body) != 3 {
+		return
+	}
+	changed, _ := sig.Body[1].(map[string]dbus.Variant)
+	invalidated, _ := sig.Body[2].([]string)
+
+	values := make(map[string]dbus.Variant, len(invalidated))
+	for _, name := range invalidated {
+		var v dbus.Variant
+		if err := p.obj.Call("org.freedesktop.DBus.Properties.Get", 0, p.iface, name).Store(&v); err == nil {
+			values[name] = v
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.props == nil {
+		return // will be reloaded when the service appears
+	}
+	for name, v := range changed {
+		p.props[name] = v
+	}
+	for _, name := range invalidated {
+		if v, ok := values[name]; ok {
+			p.props[name] = v
+		} else {
+			delete(p.props, name)
+		}
+	}
+}
+
+// Object returns the object, for calling methods or setting properties.
+func (p *Properties) Object() dbus.BusObject {
+	return p.obj
+}
+
+// Changed returns a channel which is notified when the properties change or
+// the service appears or disappears. The buffer size is 1.
+func (p *Properties) Changed() <-chan struct{} {
+	return p.changed
+}
+
+// Available checks whether the properties were loaded.
+func (p *Properties) Available() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.props != nil
+}
+
+// Err returns the error from the last time the properties were loaded, if
+// any.
+func (p *Properties) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Refresh reloads the properties (e.g., for services which don't emit
+// PropertiesChanged for all properties) and returns the error, if any.
+func (p *Properties) Refresh() error {
+	p.reload()
+	notify(p.changed)
+	return p.Err()
+}
+
+// Get gets a cached property.
+func (p *Properties) Get(name string) (dbus.Variant, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.props[name]
+	return v, ok
+}
+
+// Store stores a cached property into v, returning an error if the properties
+// are not available, the property doesn't exist, or it has the wrong type.
+func (p *Properties) Store(name string, v any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.props == nil {
+		if p.err != nil {
+			return p.err
+		}
+		return fmt.Errorf("properties not available")
+	}
+	x, ok := p.props[name]
+	if !ok {
+		return fmt.Errorf("no such property %s.%s", p.iface, name)
+	}
+	return x.Store(v)
+}
+
+// Close stops watching the properties.
+func (p *Properties) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.sub.Close()
+		p.svc.Close()
+		p.wg.Wait()
+	})
+}
+
+// Get gets a cached property as T.
+func Get[T any](p *Properties, name string) (T, bool) {
+	var v T
+	if err := p.Store(name, &v); err != nil {
+		return v, false
+	}
+	return v, true
+}
@@ -3,10 +3,12 @@ package barlib_test
 import (
 	"fmt"
 	"strconv"
+	"testing"
 	"time"
 
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/pgaskin/barlib"
+	"github.com/pgaskin/barlib/barlibtest"
 	"github.com/pgaskin/barlib/barproto"
 )
 
@@ -57,7 +59,7 @@ func (c Example) Run(i barlib.Instance) error {
 
 		select {
 		case <-i.Stopped():
-			i.Debug("stopped=%t", i.IsStopped())
+			i.Logger().Debug("stopped", "stopped", i.IsStopped())
 		case <-ticker:
 			if !paused {
 				count += 1
@@ -100,6 +102,99 @@ func (c Example) Run(i barlib.Instance) error {
 	}
 }
 
+func TestExample(t *testing.T) {
+	i := barlibtest.New(t, time.Second/4)
+	i.Run(Example{
+		Text: "A",
+		Rate: time.Second,
+	})
+	i.Wait()
+	i.AssertText("A ", "0")
+
+	i.Advance(time.Second / 4) // first tick
+	i.Wait()
+	i.AssertText("A ", "1")
+
+	i.Advance(time.Second / 2) // not a multiple of the rate
+	i.Advance(time.Second / 2)
+	i.Wait()
+	i.AssertText("A ", "2")
+
+	i.Click("count", 4)
+	i.Wait()
+	i.AssertText("A ", "3")
+
+	i.Click("text", 1)
+	i.Wait()
+	i.Advance(time.Second)
+	i.Wait()
+	i.AssertText("A ", "3")
+
+	i.Click("count", 3)
+	i.Wait()
+	i.AssertGolden("example")
+
+	i.Click("count", 2)
+	if err := i.WaitErr(); err == nil || err.Error() != "fake error" {
+		t.Errorf("expected fake error, got %v", err)
+	}
+}
+
+func TestExampleStopped(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.ModuleFunc(func(i barlib.Instance) error {
+		var (
+			s1, s2 = i.Tick(time.Second), i.Tick(time.Second * 2)
+			n1, n2 = "-", "-"
+		)
+		for {
+			i.Update(false, func(render barlib.Renderer) {
+				render(barproto.Block{FullText: n1})
+				render(barproto.Block{FullText: n2})
+			})
+			for {
+				select {
+				case n := <-s1:
+					n1 = strconv.FormatUint(n, 10)
+				case n := <-s2:
+					n2 = strconv.FormatUint(n, 10)
+				case <-i.Stopped():
+					continue
+				case <-i.Context().Done():
+					return i.Context().Err()
+				}
+				break
+			}
+		}
+	}))
+	i.Wait()
+	i.AssertText("-", "-")
+
+	i.Advance(time.Second)
+	i.Wait()
+	i.Wait()
+	i.AssertText("0", "0")
+
+	i.Advance(time.Second)
+	i.Wait()
+	i.AssertText("1", "0")
+
+	i.SetStopped(true)
+	i.Advance(time.Second * 3)
+	if n := len(i.Updates()); n != 4 {
+		t.Errorf("unexpected ticks while stopped (%d updates)", n)
+	}
+
+	i.SetStopped(false) // catch-up tick for both
+	i.Wait()
+	i.Wait()
+	i.AssertText("4", "4")
+
+	i.Advance(time.Second)
+	i.Wait()
+	i.AssertText("5", "4")
+}
+
 func ExampleMain() {
 	barlib.Main(time.Second/4,
 		Example{
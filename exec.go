@@ -0,0 +1,209 @@
+package barlib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Exec is a module which runs an external status command speaking the i3bar
+// protocol (e.g., i3status or i3blocks), like i3bar's status_command.
+//
+// The child's blocks are rendered as-is, with the name and instance combined
+// into the instance so click events can be forwarded back to it if it enabled
+// them. The child is started in a new process group, which is sent its stop and
+// continue signals when the bar is stopped and continued. Lines written to
+// stderr are logged.
+type Exec struct {
+	Command []string // argv (use "sh", "-c", ... for a shell command)
+	Dir     string   // working directory (default: current)
+	Env     []string // additional environment variables
+}
+
+func (m Exec) Run(i Instance) error {
+	if len(m.Command) == 0 {
+		return fmt.Errorf("no command specified")
+	}
+
+	ctx, cancel := context.WithCancel(i.Context())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, m.Command[0], m.Command[1:]...)
+	cmd.Dir = m.Dir
+	if len(m.Env) != 0 {
+		cmd.Env = append(os.Environ(), m.Env...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT) // in case it's stopped
+		return err
+	}
+	cmd.WaitDelay = time.Second * 2
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = &execStderr{logger: i.Logger()}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		if cmd.ProcessState == nil {
+			cancel()
+			cmd.Wait()
+		}
+	}()
+
+	dec := barproto.NewDecoder(stdout)
+	header, err := dec.Header()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if header.StopSignal == 0 {
+		header.StopSignal = syscall.SIGSTOP
+	}
+	if header.ContSignal == 0 {
+		header.ContSignal = syscall.SIGCONT
+	}
+
+	var (
+		lines   = make(chan []barproto.Block, 1)
+		readErr = make(chan error, 1)
+	)
+	go func() {
+		for {
+			blocks, err := dec.Next()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case <-lines: // replace the previous one if it hasn't been rendered yet
+			default:
+			}
+			lines <- blocks
+		}
+	}()
+
+	var (
+		stopped bool
+		events  []byte
+	)
+	if header.ClickEvents {
+		events = append(events, "[\n"...)
+	}
+	for {
+		if s := i.IsStopped(); s != stopped {
+			stopped = s
+			sig := header.ContSignal
+			if stopped {
+				sig = header.StopSignal
+			}
+			if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+				return fmt.Errorf("send %s: %w", sig, err)
+			}
+		}
+		select {
+		case blocks := <-lines:
+			i.Update(false, func(render Renderer) {
+				for _, block := range blocks {
+					block.Name, block.Instance = "", execInstance(block.Name, block.Instance)
+					render(block)
+				}
+			})
+		case err := <-readErr:
+			var werr error
+			if errors.Is(err, io.EOF) {
+				var killed bool
+				if killed, werr = waitClosed(cmd, cancel); killed {
+					err = fmt.Errorf("command closed stdout")
+				} else {
+					err = fmt.Errorf("command exited")
+				}
+			} else {
+				cancel() // it might still be running
+				werr = cmd.Wait()
+			}
+			if werr != nil {
+				err = fmt.Errorf("%w (%w)", err, werr)
+			}
+			return err
+		case event := <-i.Event():
+			if !header.ClickEvents || event.Release {
+				continue // i3bar doesn't send release events
+			}
+			event.Name, event.Instance = execSplitInstance(event.Instance)
+			events = event.AppendJSON(events)
+			events = append(events, '\n')
+			if _, err := stdin.Write(events); err != nil {
+				return fmt.Errorf("write event: %w", err)
+			}
+			events = append(events[:0], ',')
+		case <-i.Stopped():
+		case <-i.Context().Done():
+			return i.Context().Err()
+		}
+	}
+}
+
+// execCloseDelay is how long to wait for a command to exit after it closes
+// stdout before killing it.
+const execCloseDelay = time.Second
+
+// waitClosed waits for cmd to exit after it closed stdout, calling cancel if it
+// is still running after execCloseDelay. If it was cancelled, killed is true.
+func waitClosed(cmd *exec.Cmd, cancel context.CancelFunc) (killed bool, err error) {
+	t := time.AfterFunc(execCloseDelay, cancel)
+	err = cmd.Wait()
+	return !t.Stop(), err
+}
+
+// execInstance combines a block name and instance, escaping the name so it can
+// be split again by execSplitInstance.
+func execInstance(name, instance string) string {
+	return url.PathEscape(name) + "/" + instance
+}
+
+func execSplitInstance(s string) (name, instance string) {
+	name, instance, _ = strings.Cut(s, "/")
+	if v, err := url.PathUnescape(name); err == nil {
+		name = v
+	}
+	return
+}
+
+// execStderr logs lines written to it.
+type execStderr struct {
+	logger *slog.Logger
+	buf    []byte
+}
+
+func (w *execStderr) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		line, rest, ok := bytes.Cut(w.buf, []byte{'\n'})
+		if !ok {
+			break
+		}
+		w.logger.Warn("stderr", "line", string(line))
+		w.buf = append(w.buf[:0], rest...)
+	}
+	return len(b), nil
+}
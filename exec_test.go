@@ -0,0 +1,116 @@
+package barlib_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/barlib"
+	"github.com/pgaskin/barlib/barlibtest"
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestExec(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Exec{
+		Command: []string{"sh", "-c", `
+			trap 'echo ",[{\"full_text\":\"stopped\"}]"' USR1
+			trap 'echo ",[{\"full_text\":\"continued\"}]"' USR2
+			echo '{"version":1,"click_events":true,"stop_signal":10,"cont_signal":12}'
+			echo '['
+			echo '[{"full_text":"a","name":"x/y","instance":"i","separator":false}]'
+			read -r start
+			read -r event
+			case "$start $event" in
+			'[ {"name":"x/y","instance":"i","button":1,'*) echo ',[{"full_text":"clicked"}]' ;;
+			*) echo ',[{"full_text":"bad event"}]' ;;
+			esac
+			while :; do read -r event; done
+		`},
+	})
+
+	i.Wait()
+	i.AssertBlocks(barproto.Block{FullText: "a", Instance: "x%2Fy/i", SeparatorBlockWidth: -1})
+
+	i.Click("x%2Fy/i", 1)
+	if u := i.Wait(); !reflect.DeepEqual(u.Text(), []string{"clicked"}) {
+		t.Errorf("expected clicked, got %q", u.Text())
+	}
+
+	i.SetStopped(true)
+	if u := i.Wait(); !reflect.DeepEqual(u.Text(), []string{"stopped"}) {
+		t.Errorf("expected stopped, got %q", u.Text())
+	}
+
+	i.SetStopped(false)
+	if u := i.Wait(); !reflect.DeepEqual(u.Text(), []string{"continued"}) {
+		t.Errorf("expected continued, got %q", u.Text())
+	}
+
+	i.Stop()
+	if err := i.WaitErr(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+}
+
+func TestExecExit(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Exec{
+		Command: []string{"sh", "-c", `
+			echo '{"version":1}'
+			echo '[[{"full_text":"a"}]'
+			exit 3
+		`},
+	})
+	i.Wait()
+	i.AssertText("a")
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("expected exit status error, got %v", err)
+	}
+
+	i = barlibtest.New(t, time.Second)
+	i.Run(barlib.Exec{
+		Command: []string{"sh", "-c", `echo 'not json'`},
+	})
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "header") {
+		t.Errorf("expected header error, got %v", err)
+	}
+}
+
+func TestExecInvalid(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Exec{
+		Command: []string{"sh", "-c", `
+			echo '{"version":1}'
+			echo '['
+			echo '[{"full_text":"a"}]'
+			echo ',[{"nofull":1}]'
+			exec sleep 60
+		`},
+	})
+	i.Wait()
+	i.AssertText("a")
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "full_text") {
+		t.Errorf("expected decode error, got %v", err)
+	}
+}
+
+func TestExecCloseStdout(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Exec{
+		Command: []string{"sh", "-c", `
+			echo '{"version":1}'
+			echo '[[{"full_text":"a"}]'
+			exec >&-
+			sleep 100
+		`},
+	})
+	i.Wait()
+	i.AssertText("a")
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "closed stdout") {
+		t.Errorf("expected closed stdout error, got %v", err)
+	}
+}
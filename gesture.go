@@ -0,0 +1,195 @@
+package barlib
+
+import (
+	"math"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// GestureKind is the type of a recognized gesture.
+type GestureKind int
+
+const (
+	Click       GestureKind = iota // single click (always sent immediately on press)
+	DoubleClick                    // second click in a row
+	TripleClick                    // third click in a row
+	Hold                           // button held down (only if the bar sends release events)
+	ScrollUp                       // button 4
+	ScrollDown                     // button 5
+	ScrollLeft                     // button 6
+	ScrollRight                    // button 7
+)
+
+func (k GestureKind) String() string {
+	switch k {
+	case Click:
+		return "click"
+	case DoubleClick:
+		return "double-click"
+	case TripleClick:
+		return "triple-click"
+	case Hold:
+		return "hold"
+	case ScrollUp:
+		return "scroll-up"
+	case ScrollDown:
+		return "scroll-down"
+	case ScrollLeft:
+		return "scroll-left"
+	case ScrollRight:
+		return "scroll-right"
+	}
+	return "unknown"
+}
+
+// Gesture is a gesture recognized from one or more events.
+type Gesture struct {
+	barproto.Event // the last event of the gesture
+
+	Kind     GestureKind
+	Velocity float64 // smoothed scroll events per second in the same direction
+	Accel    float64 // scroll acceleration multiplier (at least 1)
+}
+
+// Step scales n by the scroll acceleration, returning at least n.
+func (g Gesture) Step(n int) int {
+	return max(n, int(math.Round(float64(n)*g.Accel)))
+}
+
+// GestureOptions configures gesture recognition. Zero values use the
+// defaults.
+type GestureOptions struct {
+	MultiClick time.Duration // max time between clicks (default 400ms)
+	Hold       time.Duration // min time to hold a button (default 600ms)
+	ScrollIdle time.Duration // time between scrolls to reset the velocity (default 300ms)
+	AccelRate  float64       // scroll velocity (events/second) for 2x acceleration (default 10)
+	MaxAccel   float64       // max scroll acceleration (default 5)
+}
+
+// RecognizeGestures recognizes gestures from the instance's events, which must
+// not be read from [Instance.Event] directly. Gestures are sent until the
+// instance context is cancelled. Up to 16 gestures are buffered.
+//
+// Consecutive clicks of the same button on the same block are numbered, and
+// scrolls are accelerated based on the velocity. Since most bars only send
+// press events, holds are only recognized after a release event (see
+// [barproto.Event.Release]) has been received.
+func RecognizeGestures(i Instance, opt GestureOptions) <-chan Gesture {
+	if opt.MultiClick <= 0 {
+		opt.MultiClick = time.Millisecond * 400
+	}
+	if opt.Hold <= 0 {
+		opt.Hold = time.Millisecond * 600
+	}
+	if opt.ScrollIdle <= 0 {
+		opt.ScrollIdle = time.Millisecond * 300
+	}
+	if opt.AccelRate <= 0 {
+		opt.AccelRate = 10
+	}
+	if opt.MaxAccel < 1 {
+		opt.MaxAccel = 5
+	}
+	ch := make(chan Gesture, 16)
+	ctx := i.Context()
+	go func() {
+		var r gestureRecognizer
+		r.opt = opt
+		r.hold = time.NewTimer(r.opt.Hold)
+		r.hold.Stop()
+		for {
+			var gs []Gesture
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-i.Event():
+				gs = r.event(event, time.Now())
+			case <-r.hold.C:
+				gs = r.held()
+			}
+			for _, g := range gs {
+				select {
+				case ch <- g:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+type gestureRecognizer struct {
+	opt GestureOptions
+
+	// clicks
+	click      barproto.Event
+	clickTime  time.Time
+	clickCount int
+
+	// holds
+	release bool // whether release events have been seen
+	press   *barproto.Event
+	hold    *time.Timer
+
+	// scrolls
+	scroll     barproto.Event
+	scrollTime time.Time
+	velocity   float64
+}
+
+func (r *gestureRecognizer) event(event barproto.Event, now time.Time) []Gesture {
+	if event.Release {
+		r.release = true
+		if r.press != nil && r.press.Button == event.Button && r.press.Instance == event.Instance {
+			r.press = nil
+			r.hold.Stop()
+		}
+		return nil
+	}
+	switch event.Button {
+	case 4, 5, 6, 7:
+		if event.Button != r.scroll.Button || event.Instance != r.scroll.Instance || now.Sub(r.scrollTime) > r.opt.ScrollIdle {
+			r.velocity = 0
+		} else if dt := now.Sub(r.scrollTime).Seconds(); dt > 0 {
+			r.velocity = r.velocity/2 + 1/dt/2
+		}
+		r.scroll, r.scrollTime = event, now
+		return []Gesture{{
+			Event:    event,
+			Kind:     ScrollUp + GestureKind(event.Button-4),
+			Velocity: r.velocity,
+			Accel:    min(max(1, r.velocity/r.opt.AccelRate*2), r.opt.MaxAccel),
+		}}
+	}
+	if event.Button == r.click.Button && event.Instance == r.click.Instance && now.Sub(r.clickTime) <= r.opt.MultiClick && r.clickCount < 3 {
+		r.clickCount++
+	} else {
+		r.clickCount = 1
+	}
+	r.click, r.clickTime = event, now
+	if r.release {
+		r.press = &event
+		r.hold.Reset(r.opt.Hold)
+	}
+	return []Gesture{{
+		Event: event,
+		Kind:  Click + GestureKind(r.clickCount-1),
+		Accel: 1,
+	}}
+}
+
+func (r *gestureRecognizer) held() []Gesture {
+	if r.press == nil {
+		return nil
+	}
+	event := *r.press
+	r.press = nil
+	r.clickCount = 0 // don't count the next press as a multi-click
+	return []Gesture{{
+		Event: event,
+		Kind:  Hold,
+		Accel: 1,
+	}}
+}
@@ -0,0 +1,91 @@
+package barlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestGestures(t *testing.T) {
+	r := gestureRecognizer{opt: GestureOptions{
+		MultiClick: time.Millisecond * 400,
+		Hold:       time.Millisecond * 600,
+		ScrollIdle: time.Millisecond * 300,
+		AccelRate:  10,
+		MaxAccel:   5,
+	}}
+	r.hold = time.NewTimer(time.Hour)
+	r.hold.Stop()
+
+	var now time.Time
+	send := func(after time.Duration, event string) Gesture {
+		t.Helper()
+		var ev barproto.Event
+		ev.FromJSON([]byte(event))
+		now = now.Add(after)
+		gs := r.event(ev, now)
+		if ev.Release {
+			if len(gs) != 0 {
+				t.Fatalf("%s: expected no gestures for release, got %v", event, gs)
+			}
+			return Gesture{}
+		}
+		if len(gs) != 1 {
+			t.Fatalf("%s: expected 1 gesture, got %d", event, len(gs))
+		}
+		return gs[0]
+	}
+
+	for _, tc := range []struct {
+		After time.Duration
+		Event string
+		Kind  GestureKind
+	}{
+		{0, `{"button":1,"instance":"a"}`, Click},
+		{time.Millisecond * 100, `{"button":1,"instance":"a"}`, DoubleClick},
+		{time.Millisecond * 100, `{"button":1,"instance":"a"}`, TripleClick},
+		{time.Millisecond * 100, `{"button":1,"instance":"a"}`, Click},
+		{time.Millisecond * 100, `{"button":1,"instance":"b"}`, Click},
+		{time.Millisecond * 100, `{"button":3,"instance":"b"}`, Click},
+		{time.Millisecond * 500, `{"button":3,"instance":"b"}`, Click},
+		{0, `{"button":6}`, ScrollLeft},
+		{0, `{"button":7}`, ScrollRight},
+	} {
+		if g := send(tc.After, tc.Event); g.Kind != tc.Kind {
+			t.Errorf("%s: expected %s, got %s", tc.Event, tc.Kind, g.Kind)
+		}
+	}
+
+	if g := send(time.Second, `{"button":4}`); g.Kind != ScrollUp || g.Accel != 1 || g.Step(2) != 2 {
+		t.Errorf("expected unaccelerated scroll up, got %+v", g)
+	}
+	var g Gesture
+	for range 10 {
+		g = send(time.Millisecond*20, `{"button":4}`)
+	}
+	if g.Accel != 5 || g.Step(2) != 10 {
+		t.Errorf("expected max scroll acceleration, got %+v", g)
+	}
+	if g = send(time.Millisecond*20, `{"button":5}`); g.Kind != ScrollDown || g.Accel != 1 {
+		t.Errorf("expected direction change to reset acceleration, got %+v", g)
+	}
+	if g = send(time.Second, `{"button":5}`); g.Accel != 1 {
+		t.Errorf("expected idle to reset acceleration, got %+v", g)
+	}
+
+	if r.press != nil {
+		t.Fatalf("expected holds to be disabled before a release event")
+	}
+	send(time.Second, `{"button":1,"release":true}`)
+	send(time.Second, `{"button":1,"instance":"a"}`)
+	if gs := r.held(); len(gs) != 1 || gs[0].Kind != Hold || gs[0].Instance != "a" {
+		t.Errorf("expected hold, got %v", gs)
+	}
+	send(time.Second, `{"button":1,"instance":"a","release":true}`)
+	send(time.Millisecond*100, `{"button":1,"instance":"a"}`)
+	send(time.Millisecond*100, `{"button":1,"instance":"a","release":true}`)
+	if gs := r.held(); len(gs) != 0 {
+		t.Errorf("expected no hold after release, got %v", gs)
+	}
+}
@@ -0,0 +1,120 @@
+package barlib
+
+import (
+	"math/bits"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Handler handles click events for a rendered block. Handlers are attached to
+// blocks by instance when rendering (see [Instance.Attach]), and events for the
+// block instance are routed to the handler from the most recent update with the
+// most specific matching modifiers.
+type Handler struct {
+	buttons uint32
+	mods    int
+	fn      func(barproto.Event)
+}
+
+// OnButton handles events for the specified buttons.
+func OnButton(fn func(barproto.Event), buttons ...int) Handler {
+	var h Handler
+	for _, b := range buttons {
+		if b >= 0 && b < 32 {
+			h.buttons |= 1 << b
+		}
+	}
+	h.fn = fn
+	return h
+}
+
+// OnClick handles left clicks.
+func OnClick(fn func(barproto.Event)) Handler {
+	return OnButton(fn, 1)
+}
+
+// OnMiddle handles middle clicks.
+func OnMiddle(fn func(barproto.Event)) Handler {
+	return OnButton(fn, 2)
+}
+
+// OnRight handles right clicks.
+func OnRight(fn func(barproto.Event)) Handler {
+	return OnButton(fn, 3)
+}
+
+// OnScroll handles vertical scrolling, where delta is 1 for up and -1 for
+// down.
+func OnScroll(fn func(event barproto.Event, delta int)) Handler {
+	return OnButton(func(event barproto.Event) {
+		if event.Button == 4 {
+			fn(event, 1)
+		} else {
+			fn(event, -1)
+		}
+	}, 4, 5)
+}
+
+// With returns a copy of the handler which only handles events with the
+// specified modifiers (xproto.ModMask*) held. Other modifiers are ignored.
+func (h Handler) With(mods int) Handler {
+	h.mods |= mods
+	return h
+}
+
+// Match checks whether the handler handles the event.
+func (h Handler) Match(event barproto.Event) bool {
+	return h.fn != nil && !event.Release && event.Button >= 0 && event.Button < 32 && h.buttons&(1<<event.Button) != 0 && event.Modifiers&h.mods == h.mods
+}
+
+// Handlers routes events to handlers by block instance. The zero value is
+// ready to use. It is used internally by the bar, and is exported for
+// implementing [Instance].
+type Handlers struct {
+	m map[string][]Handler
+}
+
+// Reset removes all handlers.
+func (hs *Handlers) Reset() {
+	clear(hs.m)
+}
+
+// Add adds handlers for the block instance.
+func (hs *Handlers) Add(instance string, h ...Handler) {
+	if len(h) == 0 {
+		return
+	}
+	if hs.m == nil {
+		hs.m = make(map[string][]Handler)
+	}
+	hs.m[instance] = append(hs.m[instance], h...)
+}
+
+// buttons returns a bitmask of the buttons handled for the block instance.
+func (hs *Handlers) buttons(instance string) uint32 {
+	var m uint32
+	for _, h := range hs.m[instance] {
+		if h.fn != nil {
+			m |= h.buttons
+		}
+	}
+	return m
+}
+
+// Route returns a function which calls the most specific handler for the
+// event, if any.
+func (hs *Handlers) Route(event barproto.Event) (func(), bool) {
+	var (
+		match Handler
+		found bool
+	)
+	for _, h := range hs.m[event.Instance] {
+		if h.Match(event) && (!found || bits.OnesCount(uint(h.mods)) > bits.OnesCount(uint(match.mods))) {
+			match, found = h, true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	return func() { match.fn(event) }, true
+}
@@ -0,0 +1,67 @@
+package barlib_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/pgaskin/barlib"
+	"github.com/pgaskin/barlib/barlibtest"
+	"github.com/pgaskin/barlib/barproto"
+)
+
+type handlerModule struct{}
+
+func (handlerModule) Run(i barlib.Instance) error {
+	var (
+		count int
+		last  string
+	)
+	for {
+		i.Update(true, func(render barlib.Renderer) {
+			render(barproto.Block{
+				Instance: "count",
+				FullText: strconv.Itoa(count) + " " + last,
+			})
+			i.Attach("count",
+				barlib.OnClick(func(barproto.Event) { count++; last = "click" }),
+				barlib.OnClick(func(barproto.Event) { count += 10; last = "shift-click" }).With(xproto.ModMaskShift),
+				barlib.OnScroll(func(_ barproto.Event, delta int) { count += delta; last = "scroll" }),
+			)
+		})
+		select {
+		case <-i.Context().Done():
+			return nil
+		case fn := <-i.Handle():
+			fn()
+		case event := <-i.Event():
+			last = "event " + strconv.Itoa(event.Button)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(handlerModule{})
+	i.Wait()
+
+	for _, tc := range []struct {
+		Event barproto.Event
+		Exp   string
+	}{
+		{barproto.Event{Instance: "count", Button: 1}, "1 click"},
+		{barproto.Event{Instance: "count", Button: 1, Modifiers: xproto.ModMaskShift | xproto.ModMask2}, "11 shift-click"},
+		{barproto.Event{Instance: "count", Button: 1, Modifiers: xproto.ModMask2}, "12 click"},
+		{barproto.Event{Instance: "count", Button: 5}, "11 scroll"},
+		{barproto.Event{Instance: "count", Button: 4}, "12 scroll"},
+		{barproto.Event{Instance: "count", Button: 3}, "12 event 3"},
+		{barproto.Event{Instance: "other", Button: 1}, "12 event 1"},
+		{barproto.Event{Instance: "count", Button: 1, Release: true}, "12 event 1"},
+	} {
+		i.Send(tc.Event)
+		if act := i.Wait().Text(); len(act) != 1 || act[0] != tc.Exp {
+			t.Errorf("%+v: expected %q, got %q", tc.Event, tc.Exp, act)
+		}
+	}
+}
@@ -15,9 +15,15 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pgaskin/barlib"
@@ -35,6 +41,10 @@ import (
 	go build -o /tmp/i3status-custom .
 	pkill -f bar_id=test
 	i3bar --bar_id=test --verbose
+
+	/tmp/i3status-custom -daemon &
+	bar { status_command exec barlibctl attach }
+	bar { output HDMI-1; status_command exec barlibctl attach Time Battery }
 */
 
 /*
@@ -51,7 +61,29 @@ import (
 	i3bar-river --config config
 */
 
+/*
+	"custom/volume": {
+		"exec": "/tmp/i3status-custom -waybar PulseAudio",
+		"return-type": "json",
+		"on-click": "barlibctl -socket $XDG_RUNTIME_DIR/barlib.waybar.PulseAudio.sock click PulseAudio 1 snk_vol",
+		"on-scroll-up": "barlibctl -socket $XDG_RUNTIME_DIR/barlib.waybar.PulseAudio.sock click PulseAudio 4 snk_vol",
+		"on-scroll-down": "barlibctl -socket $XDG_RUNTIME_DIR/barlib.waybar.PulseAudio.sock click PulseAudio 5 snk_vol"
+	}
+*/
+
 func main() {
+	waybar := flag.String("waybar", "", "run the comma-separated modules as a waybar custom module (with the control socket at barlib.waybar.NAME.sock)")
+	daemon := flag.Bool("daemon", false, "run as a daemon for bars using barlibctl attach as the status command")
+	themeName := flag.String("theme", "i3", "color theme (i3, solarized, gruvbox)")
+	stateName := flag.String("state", "", "name of the state file, for running multiple bars at once (default: based on the mode)")
+	flag.Parse()
+
+	theme, ok := barlib.ThemeByName(*themeName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fatal: unknown theme %q\n", *themeName)
+		os.Exit(2)
+	}
+
 	var mid string
 	if buf, err := os.ReadFile("/etc/machine-id"); err == nil {
 		mid = string(buf)
@@ -67,6 +99,19 @@ func main() {
 	var (
 		mods []barlib.Module
 
+		// for modules which fail transiently when a device disappears
+		autoRestart = barlib.RestartPolicy{
+			Auto:       true,
+			Backoff:    time.Second * 5,
+			MaxBackoff: time.Minute * 5,
+		}
+		ddcRestart = barlib.RestartPolicy{
+			Auto:       true,
+			Backoff:    time.Second * 5,
+			MaxBackoff: time.Minute * 5,
+			Hide:       true,
+		}
+
 		is = func(mids ...string) bool {
 			return slices.ContainsFunc(mids, func(x string) bool {
 				return strings.HasPrefix(mid, x)
@@ -79,7 +124,10 @@ func main() {
 		}
 	)
 
-	add(CMUS{}, p1, s1, s2) // TODO: generic mpris?
+	add(CMUS{
+		MaxWidth: 48,
+		Scroll:   time.Second / 2,
+	}, p1, s1, s2) // TODO: generic mpris?
 
 	add(PulseAudio{
 		ShowSink:   true,
@@ -91,6 +139,7 @@ func main() {
 		Subsystem:   "backlight",
 		Name:        "amdgpu_bl1",
 		SessionName: "self",
+		Signal:      1,
 	}, p1, s1)
 
 	add(Backlight{
@@ -98,6 +147,7 @@ func main() {
 		Subsystem:   "backlight",
 		Name:        "intel_backlight",
 		SessionName: "auto",
+		Signal:      1,
 	}, s2)
 
 	add(Redshift{
@@ -111,7 +161,7 @@ func main() {
 
 	add(XRandR{}, p1)
 
-	add(DDC{
+	add(barlib.WithRestart(DDC{
 		Interval:   time.Minute,
 		ID:         "ACRE70C-A55C5042",
 		HideIfGone: true,
@@ -132,9 +182,9 @@ func main() {
 			{100, 75},
 			{100, 100},
 		},
-	}, p1)
+	}, ddcRestart), p1)
 
-	add(DDC{
+	add(barlib.WithRestart(DDC{
 		Interval:   time.Minute,
 		ID:         "ACRE70C-00000000", //"ACRE70C-9C5E5042", (the Cable Matters 201376-BLK is nice but it doesn't pass the edid serial properly)
 		HideIfGone: true,
@@ -155,9 +205,9 @@ func main() {
 			{100, 75},
 			{100, 100},
 		},
-	}, p1)
+	}, ddcRestart), p1)
 
-	add(DDC{
+	add(barlib.WithRestart(DDC{
 		Interval:   time.Minute,
 		ID:         "ACR2406-F2179101",
 		HideIfGone: true,
@@ -170,7 +220,7 @@ func main() {
 			{60, 60},
 			{100, 80},
 		},
-	}, p1)
+	}, ddcRestart), p1)
 
 	add(Battery{
 		Name: "BAT0",
@@ -178,35 +228,35 @@ func main() {
 
 	add(PowerProfiles{}, s2)
 
-	add(BluezDevice{
+	add(barlib.WithRestart(BluezDevice{
 		Label:   "\uf025",
 		Adapter: "hci0",
 		Name:    "dev_00_1B_66_10_CA_67",
-	}, p1)
+	}, autoRestart), p1)
 
-	add(BluezDevice{
+	add(barlib.WithRestart(BluezDevice{
 		Label:   "\uf025",
 		Adapter: "hci0",
 		Name:    "dev_74_F8_DB_95_10_72",
-	}, p1)
+	}, autoRestart), p1)
 
-	add(BluezDevice{
+	add(barlib.WithRestart(BluezDevice{
 		Label:   "\uf58f",
 		Adapter: "hci0",
 		Name:    "dev_F0_AE_66_B2_4E_95",
-	}, p1)
+	}, autoRestart), p1)
 
-	add(BluezDevice{
+	add(barlib.WithRestart(BluezDevice{
 		Label:   "\uf8cd",
 		Adapter: "hci0",
 		Name:    "dev_DF_78_76_F8_EC_1E", // M575S
-	}, s2)
+	}, autoRestart), s2)
 
-	add(BluezDevice{
+	add(barlib.WithRestart(BluezDevice{
 		Label:   "\uf11c",
 		Adapter: "hci0",
 		Name:    "dev_DC_93_71_31_A6_A5", // keyboard
-	}, s2)
+	}, autoRestart), s2)
 
 	add(Interfaces{
 		Interval: time.Second * 5,
@@ -237,14 +287,13 @@ func main() {
 	add(WiFi{
 		Interval:       time.Second * 5,
 		Threshold:      -70,
-		ThresholdColor: 0xFFFF00FF,
+		ThresholdColor: theme.Degraded,
 	}, p1, s1, s2)
 
 	add(Disk{
-		Interval:       time.Second * 5,
-		Threshold:      10 * 1024 * 1024 * 1024,
-		ThresholdColor: 0xFFFF00FF,
-		Mountpoint:     "/home",
+		Interval:   time.Second * 5,
+		Threshold:  10 * 1024 * 1024 * 1024,
+		Mountpoint: "/home",
 	})
 
 	if is(s2) {
@@ -260,10 +309,12 @@ func main() {
 				7: 2, // LPE
 			},
 			Interval: time.Second * 3,
+			History:  10,
 		})
 	} else {
 		add(CPU{
 			Interval: time.Second * 3,
+			History:  10,
 		})
 	}
 
@@ -284,16 +335,16 @@ func main() {
 	}, p1, s1, s2)
 
 	add(Memory{
-		Interval:       time.Second * 3,
-		Threshold:      1 * 1024 * 1024 * 1024,
-		ThresholdColor: 0xFFFF00FF,
+		Interval:  time.Second * 3,
+		Threshold: 1 * 1024 * 1024 * 1024,
+		Bar:       4,
 	})
 
 	add(Time{
 		LayoutFull:  "Mon 01/02 15:04:05",
 		LayoutShort: "15:04",
 		Interval:    time.Second,
-		Color:       0x87CEEBFF,
+		Color:       theme.Accent,
 	})
 
 	if niri {
@@ -302,5 +353,41 @@ func main() {
 		add(Dunst{})
 	}
 
-	barlib.Main(time.Second/4, mods...)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level:     slog.LevelInfo,
+		AddSource: true,
+	})))
+
+	opt := barlib.Options{
+		Stdin:         os.Stdin,
+		Stdout:        os.Stdout,
+		TickRate:      time.Second / 4,
+		StopSignal:    syscall.SIGUSR1,
+		ContSignal:    syscall.SIGUSR2,
+		ControlSocket: barlib.DefaultControlSocket(),
+		WatchBinary:   true,
+		StateFile:     barlib.DefaultStateFile(*stateName),
+		Theme:         &theme,
+	}
+	switch {
+	case *waybar != "":
+		opt.Stdin = nil
+		opt.StopSignal, opt.ContSignal = 0, 0
+		opt.Output = barlib.WaybarOutput{}
+		opt.Select = strings.Split(*waybar, ",")
+		opt.ControlSocket = filepath.Join(filepath.Dir(barlib.DefaultControlSocket()), "barlib.waybar."+strings.ReplaceAll(*waybar, ",", "-")+".sock")
+		if *stateName == "" {
+			opt.StateFile = barlib.DefaultStateFile("waybar." + strings.ReplaceAll(*waybar, ",", "-"))
+		}
+	case *daemon:
+		opt.Stdin, opt.Stdout = nil, nil
+		opt.ControlSocket = barlib.DefaultDaemonSocket()
+		if *stateName == "" {
+			opt.StateFile = barlib.DefaultStateFile("daemon")
+		}
+	}
+	if err := barlib.Run(context.Background(), opt, mods...); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -1,7 +1,9 @@
 // # backlight
 //
 // Reads backlight values from sysfs, and sets them using systemd-logind over
-// DBus.
+// DBus. Supports the up, down, and refresh actions (e.g., "barlibctl action
+// Backlight up" from a brightness key binding), and refreshing on a real-time
+// signal (e.g., "pkill -RTMIN+1 i3status-custom" after brightnessctl).
 package main
 
 import (
@@ -16,6 +18,7 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type Backlight struct {
@@ -24,17 +27,24 @@ type Backlight struct {
 	Name        string
 	SessionName string
 	Separator   bool
+	Signal      int // if non-zero, refresh on SIGRTMIN+Signal
 }
 
 func (c Backlight) Run(i barlib.Instance) error {
-	conn, err := dbus.SystemBus()
+	bus, err := dbusutil.SystemBus()
 	if err != nil {
 		return err
 	}
+	defer bus.Release()
+
 	var (
 		setErr       error
 		blCur, blMax uint32
+		signal       <-chan struct{}
 	)
+	if c.Signal != 0 {
+		signal = i.Signal(c.Signal)
+	}
 	for ticker, isEvent := i.Tick(c.Interval), false; ; {
 		if !i.IsStopped() {
 			blMax, err = readFileUint[uint32](filepath.Join("/sys/class", c.Subsystem, c.Name, "max_brightness"))
@@ -46,17 +56,17 @@ func (c Backlight) Run(i barlib.Instance) error {
 					if errors.Is(err, fs.ErrNotExist) {
 						render(barproto.Block{
 							FullText:            "?",
-							Color:               0xFF0000FF,
+							Color:               i.Theme().Bad,
 							Separator:           c.Separator,
 							SeparatorBlockWidth: -1,
 						})
 					} else {
-						render.Err(setErr)
+						i.Theme().Err(render, setErr)
 					}
 					return
 				}
 				if setErr != nil {
-					render.Err(setErr)
+					i.Theme().Err(render, setErr)
 					return
 				}
 				render(barproto.Block{
@@ -67,24 +77,46 @@ func (c Backlight) Run(i barlib.Instance) error {
 			})
 		}
 		for isEvent = false; ; {
+			var step int
 			select {
 			case <-ticker:
 			case <-i.Stopped():
+			case <-signal:
+				isEvent = true
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
-				blPct := int(math.Round(float64(blCur) / float64(blMax) * 100))
-				blNew := blPct
 				switch event.Button {
 				default:
 					continue
 				case 4:
+					step = 1
+				case 5:
+					step = -1
+				}
+			case action := <-i.Action():
+				switch action {
+				default:
+					continue
+				case "refresh":
 					isEvent = true
+				case "up":
+					step = 1
+				case "down":
+					step = -1
+				}
+			}
+			if step != 0 {
+				isEvent = true
+				blPct := int(math.Round(float64(blCur) / float64(blMax) * 100))
+				blNew := blPct
+				if step > 0 {
 					if blNew < 45 {
 						blNew += 1
 					} else {
 						blNew += 5
 					}
-				case 5:
-					isEvent = true
+				} else {
 					if blNew > 45 {
 						blNew -= 5
 					} else {
@@ -93,7 +125,7 @@ func (c Backlight) Run(i barlib.Instance) error {
 				}
 				if blNew != blPct {
 					blCur = uint32(min(max(float64(blNew)/100, 0), 1) * float64(blMax))
-					setErr = conn.Object("org.freedesktop.login1", dbus.ObjectPath("/org/freedesktop/login1/session/"+cmp.Or(c.SessionName, "auto"))).Call("org.freedesktop.login1.Session.SetBrightness", 0, c.Subsystem, c.Name, blCur).Err
+					setErr = bus.Conn().Object("org.freedesktop.login1", dbus.ObjectPath("/org/freedesktop/login1/session/"+cmp.Or(c.SessionName, "auto"))).Call("org.freedesktop.login1.Session.SetBrightness", 0, c.Subsystem, c.Name, blCur).Err
 				}
 			}
 			break
@@ -1,7 +1,8 @@
 // # battery
 //
 // Shows battery information for a specific battery using UPower over DBus, plus
-// sysfs for showing charge thresholds if supported.
+// sysfs for showing charge thresholds if supported. The icon shows the charge
+// level, and is colored by the state.
 package main
 
 import (
@@ -11,28 +12,42 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type Battery struct {
 	Name string
 }
 
+// batteryIcon gets the Font Awesome battery icon for the charge percentage.
+func batteryIcon(percent float64) string {
+	switch {
+	case percent >= 87.5:
+		return "\uf240" // battery-full
+	case percent >= 62.5:
+		return "\uf241" // battery-three-quarters
+	case percent >= 37.5:
+		return "\uf242" // battery-half
+	case percent >= 12.5:
+		return "\uf243" // battery-quarter
+	default:
+		return "\uf244" // battery-empty
+	}
+}
+
 func (c Battery) Run(i barlib.Instance) error {
-	conn, err := dbus.SystemBus()
+	bus, err := dbusutil.SystemBus()
 	if err != nil {
 		return err
 	}
-	obj := conn.Object("org.freedesktop.UPower", dbus.ObjectPath("/org/freedesktop/UPower/devices/battery_"+c.Name))
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath(obj.Path()),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "org.freedesktop.UPower.Device"),
-	); err != nil {
+	defer bus.Release()
+
+	props, err := bus.Properties("org.freedesktop.UPower", dbus.ObjectPath("/org/freedesktop/UPower/devices/battery_"+c.Name), "org.freedesktop.UPower.Device")
+	if err != nil {
 		return err
 	}
-	ch := make(chan *dbus.Signal, 6)
-	conn.Signal(ch)
+	defer props.Close()
+
 	for {
 		var prop struct {
 			IsPresent                   bool
@@ -50,39 +65,39 @@ func (c Battery) Run(i barlib.Instance) error {
 		}
 		err := func() error {
 			var typ uint32
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.Type", &typ); err != nil {
+			if err := props.Store("Type", &typ); err != nil {
 				return fmt.Errorf("type: %w", err)
 			} else if typ != 2 {
 				return fmt.Errorf("type: not battery")
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.IsPresent", &prop.IsPresent); err != nil {
+			if err := props.Store("IsPresent", &prop.IsPresent); err != nil {
 				return fmt.Errorf("is present: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.Energy", &prop.Energy); err != nil {
+			if err := props.Store("Energy", &prop.Energy); err != nil {
 				return fmt.Errorf("energy: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.EnergyEmpty", &prop.EnergyEmpty); err != nil {
+			if err := props.Store("EnergyEmpty", &prop.EnergyEmpty); err != nil {
 				return fmt.Errorf("energy empty: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.EnergyFull", &prop.EnergyFull); err != nil {
+			if err := props.Store("EnergyFull", &prop.EnergyFull); err != nil {
 				return fmt.Errorf("energy full: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.EnergyRate", &prop.EnergyRate); err != nil {
+			if err := props.Store("EnergyRate", &prop.EnergyRate); err != nil {
 				return fmt.Errorf("energy rate: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.Voltage", &prop.Voltage); err != nil {
+			if err := props.Store("Voltage", &prop.Voltage); err != nil {
 				return fmt.Errorf("voltage: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.ChargeCycles", &prop.ChargeCycles); err != nil {
+			if err := props.Store("ChargeCycles", &prop.ChargeCycles); err != nil {
 				return fmt.Errorf("charge cycles: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.TimeToEmpty", &prop.TimeToEmpty); err != nil {
+			if err := props.Store("TimeToEmpty", &prop.TimeToEmpty); err != nil {
 				return fmt.Errorf("time to empty: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.TimeToFull", &prop.TimeToFull); err != nil {
+			if err := props.Store("TimeToFull", &prop.TimeToFull); err != nil {
 				return fmt.Errorf("time to full: %w", err)
 			}
-			if err := obj.StoreProperty("org.freedesktop.UPower.Device.State", &prop.State); err != nil {
+			if err := props.Store("State", &prop.State); err != nil {
 				return fmt.Errorf("state: %w", err)
 			}
 			prop.ChargeControlStartThreshold, _ = readFileInt[int](filepath.Join("/sys/class/power_supply", c.Name, "charge_control_start_threshold"))
@@ -94,7 +109,7 @@ func (c Battery) Run(i barlib.Instance) error {
 		}()
 		i.Update(false, func(render barlib.Renderer) {
 			if err != nil {
-				render.Err(err)
+				i.Theme().Err(render, err)
 				return
 			}
 			var percent float64
@@ -108,7 +123,7 @@ func (c Battery) Run(i barlib.Instance) error {
 				switch prop.State {
 				case 0: // unknown
 					block.FullText = "?"
-					block.Color = 0xFF0000FF
+					block.Color = i.Theme().Bad
 				case 1: // charging
 					var threshold string
 					if prop.ChargeControlStopThreshold != 0 && prop.ChargeControlStopThreshold != 100 {
@@ -117,16 +132,16 @@ func (c Battery) Run(i barlib.Instance) error {
 						threshold = "%"
 					}
 					block.FullText = fmt.Sprintf("%.1f%s %.1fV %.1fW %d:%02d:%02d", percent, threshold, prop.Voltage, prop.EnergyRate, prop.TimeToFull/60/60, prop.TimeToFull/60%60, prop.TimeToFull%60)
-					block.Color = 0x00FF00FF
+					block.Color = i.Theme().Good
 				case 2: // discharging
 					block.FullText = fmt.Sprintf("%.1f%% %.1fV %.1fW %d:%02d:%02d", percent, prop.Voltage, prop.EnergyRate, prop.TimeToEmpty/60/60, prop.TimeToEmpty/60%60, prop.TimeToFull%60)
-					block.Color = 0xFFFF00FF
+					block.Color = i.Theme().Degraded
 				case 3: // empty
 					block.FullText = fmt.Sprintf("%.1f%% %.1fV EMPTY", percent, prop.Voltage)
-					block.Color = 0xFF0000FF
+					block.Color = i.Theme().Bad
 				case 4: // fully charged
 					block.FullText = fmt.Sprintf("%.0f%%", percent)
-					block.Color = 0x00FF00FF
+					block.Color = i.Theme().Good
 				case 5: // pending charge
 					block.FullText = fmt.Sprintf("%.0f", percent)
 					if prop.ChargeControlStartThreshold != 0 {
@@ -141,10 +156,16 @@ func (c Battery) Run(i barlib.Instance) error {
 				}
 			} else {
 				block.FullText = "-"
-				block.Color = 0xFF0000FF
+				block.Color = i.Theme().Bad
+				render(block)
+				return
 			}
-			render(block)
+			i.Theme().Icon(render, batteryIcon(percent), block)
 		})
-		<-ch
+		select {
+		case <-props.Changed():
+		case <-i.Context().Done():
+			return i.Context().Err()
+		}
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type BluezDevice struct {
@@ -18,65 +19,39 @@ type BluezDevice struct {
 }
 
 func (c BluezDevice) Run(i barlib.Instance) error {
-	conn, err := dbus.SystemBus()
+	bus, err := dbusutil.SystemBus()
 	if err != nil {
 		return err
 	}
-	obj := conn.Object("org.bluez", dbus.ObjectPath("/org/bluez/"+c.Adapter+"/"+c.Name))
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-		dbus.WithMatchArg(0, "org.bluez"),
-	); err != nil {
-		return err
-	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath(obj.Path()),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "org.bluez.Device1"),
-	); err != nil {
+	defer bus.Release()
+
+	props, err := bus.Properties("org.bluez", dbus.ObjectPath("/org/bluez/"+c.Adapter+"/"+c.Name), "org.bluez.Device1")
+	if err != nil {
 		return err
 	}
-	ch := make(chan *dbus.Signal, 6)
-	conn.Signal(ch)
+	defer props.Close()
+
+	obj := props.Object()
 	for {
-		var (
-			address   string
-			connected bool
-		)
-		if err := obj.StoreProperty("org.bluez.Device1.Address", &address); err == nil {
-			if err := obj.StoreProperty("org.bluez.Device1.Connected", &connected); err != nil {
-				return err
-			}
-		}
+		address, _ := dbusutil.Get[string](props, "Address")
+		connected, _ := dbusutil.Get[bool](props, "Connected")
 		i.Update(false, func(render barlib.Renderer) {
 			block := barproto.Block{
 				FullText:  c.Label,
 				Separator: true,
 			}
 			if address == "" {
-				block.Color = 0xFF0000FF
+				block.Color = i.Theme().Bad
 			} else if connected {
-				block.Color = 0x00FF00FF
+				block.Color = i.Theme().Good
 			}
 			render(block)
 		})
 		for {
 			select {
-			case sig := <-ch:
-				switch {
-				case sig.Sender == "org.freedesktop.DBus" && sig.Path == "/org/freedesktop/DBus" && sig.Name == "org.freedesktop.DBus.NameOwnerChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "org.bluez" {
-						continue
-					}
-				case sig.Path == obj.Path() && sig.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "org.bluez.Device1" {
-						continue
-					}
-				}
+			case <-props.Changed():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				case 1:
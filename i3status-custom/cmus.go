@@ -2,74 +2,53 @@
 //
 // Shows the status of cmus using MPRIS over DBus. Starts it in an
 // xfce4-terminal window when middle-clicked, showing and hiding it from the i3
-// scratchpad on scroll. Supports metadata, seeking, volume, and more.
+// scratchpad on scroll. Supports metadata, seeking, volume, and more. Long
+// track info can be truncated or scrolled.
 package main
 
 import (
 	"fmt"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/barproto/pango"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
-type CMUS struct{}
+type CMUS struct {
+	MaxWidth int           // max width of the track info in cells (0 for unlimited)
+	Scroll   time.Duration // if non-zero, scroll long track info at this interval instead of truncating it
+}
 
 func (c CMUS) Run(i barlib.Instance) error {
-	conn, err := dbus.SessionBus()
+	bus, err := dbusutil.SessionBus()
 	if err != nil {
 		return err
 	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.mpris.MediaPlayer2.cmus"),
-		dbus.WithMatchObjectPath("/org/mpris/MediaPlayer2"),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "org.mpris.MediaPlayer2.Player"),
-	); err != nil {
-		return err
-	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.mpris.MediaPlayer2.cmus"),
-		dbus.WithMatchObjectPath("/org/mpris/MediaPlayer2"),
-		dbus.WithMatchInterface("org.mpris.MediaPlayer2.Player"),
-		dbus.WithMatchMember("Seeked"),
-	); err != nil {
+	defer bus.Release()
+
+	props, err := bus.Properties("org.mpris.MediaPlayer2.cmus", "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+	if err != nil {
 		return err
 	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-		dbus.WithMatchArg(0, "org.mpris.MediaPlayer2.cmus"),
-	); err != nil {
+	defer props.Close()
+
+	seeked, err := bus.Subscribe(dbusutil.Match{
+		Sender:    "org.mpris.MediaPlayer2.cmus",
+		Path:      "/org/mpris/MediaPlayer2",
+		Interface: "org.mpris.MediaPlayer2.Player",
+		Member:    "Seeked",
+	})
+	if err != nil {
 		return err
 	}
-	ch := make(chan *dbus.Signal, 6)
-	{
-		var names []string
-		if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err == nil {
-			for _, name := range names {
-				if name == "org.mpris.MediaPlayer2.cmus" {
-					ch <- &dbus.Signal{
-						Sender: "org.freedesktop.DBus",
-						Path:   "/org/freedesktop/DBus",
-						Name:   "org.freedesktop.DBus.NameOwnerChanged",
-						Body: []interface{}{
-							string("org.mpris.MediaPlayer2.cmus"),
-							string(""),
-							string("dummy"),
-						},
-					}
-				}
-			}
-		}
-	}
-	conn.Signal(ch)
+	defer seeked.Close()
+
 	type State struct {
 		object   dbus.BusObject
 		metadata map[string]dbus.Variant
@@ -81,34 +60,66 @@ func (c CMUS) Run(i barlib.Instance) error {
 		view         uint64
 		state        State
 		lastShowHide time.Time
+		marquee      = barlib.Marquee{Width: c.MaxWidth}
 	)
+	i.State().Get("view", &view)
+	sync := func() error {
+		if !props.Available() {
+			state = State{}
+			return nil
+		}
+		appeared := state.object == nil
+		state.object = props.Object()
+		state.metadata = nil
+		if err := props.Store("Metadata", &state.metadata); err != nil {
+			return fmt.Errorf("metadata: %w", err)
+		}
+		if err := props.Store("PlaybackStatus", &state.status); err != nil {
+			return fmt.Errorf("playback status: %w", err)
+		}
+		if err := props.Store("Volume", &state.volume); err != nil {
+			return fmt.Errorf("volume: %w", err)
+		}
+		if appeared {
+			// not cached since it isn't included in PropertiesChanged
+			if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Position", &state.position); err != nil {
+				return fmt.Errorf("position: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := sync(); err != nil {
+		return err
+	}
 	ticker := i.Tick(0)
+	scroll := i.Tick(0)
 	for {
 		if state.object != nil && state.status == "Playing" && view >= 1 {
 			i.TickReset(ticker, time.Second/4)
 		} else {
 			i.TickReset(ticker, 0)
 		}
+		var scrolling bool
 		i.Update(true, func(render barlib.Renderer) {
 			if state.object == nil {
 				render(barproto.Block{
 					FullText:  "?",
-					Color:     0xFF0000FF,
+					Color:     i.Theme().Bad,
 					Separator: true,
 				})
 			} else {
 				view %= 4
 				var playColor uint32
 				if state.status == "Playing" {
-					playColor = 0x00FF00FF
+					playColor = i.Theme().Good
 				} else {
-					playColor = 0xFFFF00FF
+					playColor = i.Theme().Idle
 				}
 				if view >= 1 {
 					render(barproto.Block{
 						FullText:            "", // music
 						Color:               playColor,
-						SeparatorBlockWidth: 8,
+						SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 					})
 				}
 				if view >= 2 {
@@ -141,26 +152,37 @@ func (c CMUS) Run(i barlib.Instance) error {
 					if title == "" {
 						title = "?"
 					}
+					block := barproto.Block{
+						Instance: "play_pause",
+						Color:    playColor,
+					}
+					info, start := title, 0 // the title starts at start
 					if artist != "" {
-						render(barproto.Block{
-							Instance: "play_pause",
-							FullText: artist + " - " + title + " - ",
-							Color:    playColor,
-						})
-					} else {
-						render(barproto.Block{
-							Instance: "play_pause",
-							FullText: title + " - ",
-							Color:    playColor,
-						})
+						info, start = artist+" - "+title, len(artist)+len(" - ")
+					}
+					var text pango.Group
+					switch {
+					case c.MaxWidth > 0 && c.Scroll > 0 && marquee.Set(info):
+						scrolling = true
+						for off, cell := range marquee.Cells() {
+							text = cmusInfo(text, cell, off >= start)
+						}
+					case c.MaxWidth > 0 && barlib.Width(info) > c.MaxWidth:
+						t := strings.TrimSuffix(barlib.Truncate(info, c.MaxWidth), barlib.Ellipsis)
+						text = cmusInfo(text, t[:min(start, len(t))], false)
+						text = cmusInfo(text, t[min(start, len(t)):]+barlib.Ellipsis, len(t) >= start)
+					default:
+						text = cmusInfo(text, info[:start], false)
+						text = cmusInfo(text, info[start:], true)
 					}
+					render(pango.Block(block, append(text, pango.Text(" - "))))
 				}
 				if view >= 1 {
 					render(barproto.Block{
 						Instance:            "volume",
 						FullText:            strconv.Itoa(int(state.volume*100)) + "%",
 						Color:               playColor,
-						SeparatorBlockWidth: 8,
+						SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 					})
 					var length int64
 					if v := state.metadata["mpris:length"].Value(); v != nil {
@@ -171,26 +193,26 @@ func (c CMUS) Run(i barlib.Instance) error {
 							Instance:            "seek",
 							FullText:            fmt.Sprintf("%d:%02d / %d:%02d", state.position/int64(time.Second/time.Microsecond)/60, state.position/int64(time.Second/time.Microsecond)%60, length/int64(time.Second/time.Microsecond)/60, length/int64(time.Second/time.Microsecond)%60),
 							Color:               playColor,
-							SeparatorBlockWidth: 8,
+							SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 						})
 					} else {
 						render(barproto.Block{
 							Instance:            "seek",
 							FullText:            fmt.Sprintf("%d:%02d", state.position/int64(time.Second/time.Microsecond)/60, state.position/int64(time.Second/time.Microsecond)%60),
 							Color:               playColor,
-							SeparatorBlockWidth: 8,
+							SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 						})
 					}
 					render(barproto.Block{
 						Instance:            "previous",
 						FullText:            "", // previous
-						Color:               0x00FF00FF,
+						Color:               i.Theme().Good,
 						SeparatorBlockWidth: 4,
 					})
 					render(barproto.Block{
 						Instance:            "next",
 						FullText:            "", // next
-						Color:               0x00FF00FF,
+						Color:               i.Theme().Good,
 						SeparatorBlockWidth: 4,
 					})
 				}
@@ -199,114 +221,68 @@ func (c CMUS) Run(i barlib.Instance) error {
 					render(barproto.Block{
 						Instance:  "play_pause",
 						FullText:  "", // pause
-						Color:     0x00FF00FF,
+						Color:     i.Theme().Good,
 						Separator: true,
 					})
 				case "Paused":
 					render(barproto.Block{
 						Instance:  "play_pause",
 						FullText:  "", // play
-						Color:     0x00FF00FF,
+						Color:     i.Theme().Good,
 						Separator: true,
 					})
 				default:
 					render(barproto.Block{
 						Instance:  "play_pause",
 						FullText:  "", // play
-						Color:     0xFF0000FF,
+						Color:     i.Theme().Bad,
 						Separator: true,
 					})
 				}
 			}
 		})
+		if scrolling {
+			i.TickReset(scroll, c.Scroll)
+		} else {
+			i.TickReset(scroll, 0)
+		}
 		for {
 			select {
+			case <-scroll:
+				marquee.Step()
 			case <-ticker:
 				if state.object != nil {
 					if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Position", &state.position); err != nil {
 						return fmt.Errorf("position: %w", err)
 					}
 				}
-			case sig := <-ch:
-				switch {
-				case sig.Sender == "org.freedesktop.DBus" && sig.Path == "/org/freedesktop/DBus" && sig.Name == "org.freedesktop.DBus.NameOwnerChanged" && len(sig.Body) == 3:
-					var (
-						name, _     = sig.Body[0].(string)
-						oldOwner, _ = sig.Body[1].(string)
-						newOwner, _ = sig.Body[2].(string)
-					)
-					if name == "org.mpris.MediaPlayer2.cmus" {
-						if newOwner == "" {
-							state = State{}
-						} else {
-							state = State{
-								object: conn.Object("org.mpris.MediaPlayer2.cmus", "/org/mpris/MediaPlayer2"),
-							}
-							if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Metadata", &state.metadata); err != nil {
-								return fmt.Errorf("metadata: %w", err)
-							}
-							if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.PlaybackStatus", &state.status); err != nil {
-								return fmt.Errorf("playback status: %w", err)
-							}
-							if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Volume", &state.volume); err != nil {
-								return fmt.Errorf("volume: %w", err)
-							}
-							if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Position", &state.position); err != nil {
-								return fmt.Errorf("position: %w", err)
-							}
-						}
-					} else {
-						continue
-					}
-					_ = oldOwner
-				case sig.Path == "/org/mpris/MediaPlayer2" && sig.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" && len(sig.Body) == 3:
-					var (
-						object, _     = sig.Body[0].(string)
-						properties, _ = sig.Body[1].(map[string]dbus.Variant)
-					)
-					if object == "org.mpris.MediaPlayer2.Player" {
-						for k, v := range properties {
-							switch k {
-							case "Metadata":
-								state.metadata = nil
-								if err := v.Store(&state.metadata); err != nil {
-									return fmt.Errorf("metadata: %w", err)
-								}
-							case "PlaybackStatus":
-								if err := v.Store(&state.status); err != nil {
-									return fmt.Errorf("playback status: %w", err)
-								}
-							case "Volume":
-								if err := v.Store(&state.volume); err != nil {
-									return fmt.Errorf("volume: %w", err)
-								}
-							}
-						}
-					} else {
-						continue
-					}
-				case sig.Path == "/org/mpris/MediaPlayer2" && sig.Name == "org.mpris.MediaPlayer2.Player.Seeked":
+			case <-props.Changed():
+				if err := sync(); err != nil {
+					return err
+				}
+			case <-seeked.C:
+				if state.object != nil {
 					if err := state.object.StoreProperty("org.mpris.MediaPlayer2.Player.Position", &state.position); err != nil {
 						return fmt.Errorf("position: %w", err)
 					}
-				default:
-					continue
 				}
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				case 1:
 					if state.object != nil {
 						switch event.Instance {
 						case "play_pause", "seek":
-							if err := state.object.Call("org.mpris.MediaPlayer2.Player.PlayPause", dbus.FlagNoReplyExpected).Err; err != nil {
+							if err := state.object.CallWithContext(i.Context(), "org.mpris.MediaPlayer2.Player.PlayPause", dbus.FlagNoReplyExpected).Err; err != nil {
 								return err
 							}
 						case "previous":
-							if err := state.object.Call("org.mpris.MediaPlayer2.Player.Previous", dbus.FlagNoReplyExpected).Err; err != nil {
+							if err := state.object.CallWithContext(i.Context(), "org.mpris.MediaPlayer2.Player.Previous", dbus.FlagNoReplyExpected).Err; err != nil {
 								return err
 							}
 						case "next":
-							if err := state.object.Call("org.mpris.MediaPlayer2.Player.Next", dbus.FlagNoReplyExpected).Err; err != nil {
+							if err := state.object.CallWithContext(i.Context(), "org.mpris.MediaPlayer2.Player.Next", dbus.FlagNoReplyExpected).Err; err != nil {
 								return err
 							}
 						}
@@ -335,7 +311,8 @@ func (c CMUS) Run(i barlib.Instance) error {
 							}
 						}
 					}
-					view++
+					view = (view + 1) % 4
+					i.State().Set("view", view)
 					// no continue since we want to re-render immediately
 				case 4, 5:
 					if state.object != nil {
@@ -360,16 +337,16 @@ func (c CMUS) Run(i barlib.Instance) error {
 							} else {
 								delta = -5 * 1000 * 1000
 							}
-							if err := state.object.Call("org.mpris.MediaPlayer2.Player.Seek", dbus.FlagNoReplyExpected, delta).Err; err != nil {
+							if err := state.object.CallWithContext(i.Context(), "org.mpris.MediaPlayer2.Player.Seek", dbus.FlagNoReplyExpected, delta).Err; err != nil {
 								return err
 							}
 						default:
 							if time.Since(lastShowHide) >= time.Millisecond*100 {
 								if niri {
 									if event.Button == 4 {
-										_, _ = exec.Command("sh", "-c", `niri msg action move-window-to-workspace $(niri msg --json workspaces | jq '.[] | select(.is_focused) | .idx') --window-id $(niri msg --json windows | jq '.[] | select(.app_id=="cmus") | .id')`).CombinedOutput()
+										_, _ = exec.CommandContext(i.Context(), "sh", "-c", `niri msg action move-window-to-workspace $(niri msg --json workspaces | jq '.[] | select(.is_focused) | .idx') --window-id $(niri msg --json windows | jq '.[] | select(.app_id=="cmus") | .id')`).CombinedOutput()
 									} else {
-										_, _ = exec.Command("sh", "-c", `niri msg action move-window-to-workspace $(niri msg --json workspaces | jq 'max_by(.idx) | .idx + 1') --window-id $(niri msg --json windows | jq '.[] | select(.app_id=="cmus") | .id')`).CombinedOutput()
+										_, _ = exec.CommandContext(i.Context(), "sh", "-c", `niri msg action move-window-to-workspace $(niri msg --json workspaces | jq 'max_by(.idx) | .idx + 1') --window-id $(niri msg --json windows | jq '.[] | select(.app_id=="cmus") | .id')`).CombinedOutput()
 									}
 								} else {
 									if event.Button == 4 {
@@ -391,3 +368,30 @@ func (c CMUS) Run(i barlib.Instance) error {
 		}
 	}
 }
+
+// cmusInfo appends s to the track info, merging it with the last node if it has
+// the same style.
+func cmusInfo(text pango.Group, s string, title bool) pango.Group {
+	if s == "" {
+		return text
+	}
+	if len(text) != 0 {
+		switch n := text[len(text)-1].(type) {
+		case pango.Text:
+			if !title {
+				text[len(text)-1] = n + pango.Text(s)
+				return text
+			}
+		case pango.Span:
+			if title {
+				n.Content = n.Content.(pango.Text) + pango.Text(s)
+				text[len(text)-1] = n
+				return text
+			}
+		}
+	}
+	if title {
+		return append(text, pango.Span{Weight: pango.Bold, Content: pango.Text(s)})
+	}
+	return append(text, pango.Text(s))
+}
@@ -1,8 +1,8 @@
 // # cpu
 //
 // Shows the CPU usage percent over the specified interval, optionally expanding
-// to show all CPUs. Reads from procfs. Starts htop sorted by CPU usage on
-// middle-click.
+// to show all CPUs, with an optional sparkline of the total usage history.
+// Reads from procfs. Starts htop sorted by CPU usage on middle-click.
 package main
 
 import (
@@ -22,6 +22,7 @@ import (
 type CPU struct {
 	Group    []int // [cpu]group (0 to skip)
 	Interval time.Duration
+	History  int // number of intervals to show in the sparkline (0 to disable)
 }
 
 func (c CPU) Run(i barlib.Instance) error {
@@ -34,9 +35,15 @@ func (c CPU) Run(i barlib.Instance) error {
 	}
 	var (
 		expanded bool
+		resumed  bool
 		prevAgg  []cpuTime
 		prev     []cpuTime
+		prevTot  cpuTime
+		history  *barlib.Ring
 	)
+	if c.History != 0 {
+		history = barlib.NewRing(c.History)
+	}
 	if ngrp != 0 {
 		prevAgg = make([]cpuTime, ngrp)
 	} else {
@@ -81,34 +88,57 @@ func (c CPU) Run(i barlib.Instance) error {
 					prevAgg[0] = agg
 				}
 				prev = cpus
-			}
-			i.Update(isEvent, func(render barlib.Renderer) {
-				if err != nil {
-					render.Err(err)
-					return
+				if history != nil && !resumed && prevTot != (cpuTime{}) {
+					history.Push(agg.Usage(prevTot))
 				}
-				b := make([]byte, 0, len(usage)*6-1)
-				for i, pct := range usage {
-					if i != 0 {
-						b = append(b, ' ')
+				prevTot = agg
+			}
+			if resumed {
+				resumed = false // only update the baseline
+			} else {
+				i.Update(isEvent, func(render barlib.Renderer) {
+					if err != nil {
+						i.Theme().Err(render, err)
+						return
 					}
-					v := int64(math.Round(pct * 100))
-					if v < 10 {
-						b = append(b, '0')
+					b := make([]byte, 0, len(usage)*6-1)
+					for i, pct := range usage {
+						if i != 0 {
+							b = append(b, ' ')
+						}
+						v := int64(math.Round(pct * 100))
+						if v < 10 {
+							b = append(b, '0')
+						}
+						b = strconv.AppendInt(b, v, 10)
+						b = append(b, '%')
+					}
+					block := barproto.Block{
+						FullText:  string(b),
+						Separator: true,
+					}
+					if history != nil {
+						i.Theme().Sparkline(render, block, history, 0, 1)
+					} else {
+						render(block)
 					}
-					b = strconv.AppendInt(b, v, 10)
-					b = append(b, '%')
-				}
-				render(barproto.Block{
-					FullText:  string(b),
-					Separator: true,
 				})
-			})
+			}
 		}
 		for {
 			select {
 			case <-ticker:
 			case <-i.Stopped():
+			case <-i.Resumed():
+				// reset the baseline so the usage doesn't include the time
+				// before the suspend, and skip the forced tick
+				select {
+				case <-ticker:
+				default:
+				}
+				resumed = true
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				default:
@@ -1,6 +1,7 @@
 // # ddc
 //
-// Controls monitor brightness/contrast using DDC-CI.
+// Controls monitor brightness/contrast using DDC-CI. Steps faster when
+// scrolling quickly, and toggles through presets on click or horizontal scroll.
 package main
 
 import (
@@ -41,6 +42,7 @@ func (c DDC) Run(i barlib.Instance) error {
 		brCur, cnCur   uint16  // current value (if present)
 		brMax, cnMax   uint16  // maximum value (if present)
 		brSkip, cnSkip bool    // whether to skip the next update
+		gestures       = barlib.RecognizeGestures(i, barlib.GestureOptions{})
 	)
 	defer func() {
 		if ci != nil {
@@ -156,7 +158,7 @@ func (c DDC) Run(i barlib.Instance) error {
 			i.Update(isEvent, func(render barlib.Renderer) {
 				render(barproto.Block{
 					FullText:  c.ID,
-					Color:     0xFF0000FF,
+					Color:     i.Theme().Bad,
 					Separator: true,
 				})
 			})
@@ -165,12 +167,17 @@ func (c DDC) Run(i barlib.Instance) error {
 			select {
 			case <-ticker:
 			case <-i.Stopped():
-			case event := <-i.Event():
+			case <-i.Context().Done():
+				return i.Context().Err()
+			case event := <-gestures:
+				if event.Kind == barlib.Hold {
+					continue // already handled as a click when pressed
+				}
 				var (
-					next = event.Button == 1
-					prev = event.Button == 3
-					incr = event.Button == 4
-					decr = event.Button == 5
+					next = event.Button == 1 || event.Kind == barlib.ScrollRight
+					prev = event.Button == 3 || event.Kind == barlib.ScrollLeft
+					incr = event.Kind == barlib.ScrollUp
+					decr = event.Kind == barlib.ScrollDown
 				)
 				var (
 					brNew, brSet = brCur, false
@@ -178,7 +185,7 @@ func (c DDC) Run(i barlib.Instance) error {
 				)
 				switch {
 				case unauthorized:
-					if err := exec.Command("pkexec", "setfacl", "-m", "u:"+strconv.Itoa(os.Getuid())+":rw", "/dev/i2c-"+strconv.Itoa(i2c)).Run(); err != nil {
+					if err := exec.CommandContext(i.Context(), "pkexec", "setfacl", "-m", "u:"+strconv.Itoa(os.Getuid())+":rw", "/dev/i2c-"+strconv.Itoa(i2c)).Run(); err != nil {
 						return fmt.Errorf("get permissions to access i2c %d: %w", i2c, err)
 					}
 					isEvent = true
@@ -236,11 +243,11 @@ func (c DDC) Run(i barlib.Instance) error {
 						case incr:
 							switch {
 							case cur < 20:
-								cur += 1
+								cur += uint16(event.Step(1))
 							case cur < 50:
-								cur += 2
+								cur += uint16(event.Step(2))
 							default:
-								cur += 5
+								cur += uint16(event.Step(5))
 							}
 							if cur > max {
 								cur = max
@@ -248,11 +255,11 @@ func (c DDC) Run(i barlib.Instance) error {
 						case decr:
 							switch {
 							case cur > 50:
-								cur -= 5
+								cur -= uint16(event.Step(5))
 							case cur > 20:
-								cur -= 2
+								cur -= uint16(event.Step(2))
 							default:
-								cur -= 1
+								cur -= uint16(event.Step(1))
 							}
 							if cur > max {
 								cur = 0
@@ -1,7 +1,8 @@
 // # disk
 //
-// Shows the disk usage of the specified mountpoint. Updates using polling at
-// the configured interval. Starts gnome-disks on middle-click.
+// Shows the disk usage of the specified mountpoint, optionally with a usage
+// bar. Updates using polling at the configured interval or on a real-time
+// signal. Starts gnome-disks on middle-click.
 package main
 
 import (
@@ -17,64 +18,99 @@ import (
 
 type Disk struct {
 	Interval       time.Duration
-	Threshold      uint64
-	ThresholdColor uint32
+	Threshold      uint64 // available bytes at or below which ThresholdColor is used (0 to disable)
+	ThresholdColor uint32 // 0 for the theme's degraded color (it used to mean no color)
 	Mountpoint     string
+	Signal         int // if non-zero, refresh on SIGRTMIN+Signal
+	Bar            int // usage bar width (0 to disable)
 }
 
 func (c Disk) Run(i barlib.Instance) error {
-	var expanded bool
+	var (
+		expanded bool
+		signal   <-chan struct{}
+	)
+	if c.Signal != 0 {
+		signal = i.Signal(c.Signal)
+	}
+	i.State().Get("expanded", &expanded)
 	for ticker, isEvent := i.Tick(c.Interval), false; ; {
-		if !i.IsStopped() {
-			var stat unix.Statfs_t
-			err := unix.Statfs(c.Mountpoint, &stat)
-			i.Update(isEvent, func(render barlib.Renderer) {
-				if err != nil {
-					if errors.Is(err, fs.ErrNotExist) {
-						render(barproto.Block{
-							FullText:  "?",
-							Color:     0xFF0000FF,
-							Separator: true,
-						})
-					} else {
-						render.Err(err)
-					}
-					return
-				}
-				available := stat.Bavail * uint64(stat.Bsize)
-				block := barproto.Block{
-					FullText:  humanize.IBytes(available),
-					Separator: true,
-				}
-				if expanded {
-					block.FullText += " / " + humanize.IBytes(stat.Blocks*uint64(stat.Bsize))
-				}
-				if available <= c.Threshold {
-					block.Color = c.ThresholdColor
-				}
-				render(block)
-			})
-		}
-		for isEvent = false; ; {
-			select {
-			case <-ticker:
-			case <-i.Stopped():
-			case event := <-i.Event():
-				switch event.Button {
-				default:
-					continue
-				case 1:
+		var stat unix.Statfs_t
+		err := unix.Statfs(c.Mountpoint, &stat)
+		i.Update(isEvent, func(render barlib.Renderer) {
+			i.Attach("",
+				barlib.OnClick(func(barproto.Event) {
 					isEvent = true
-				case 2:
+				}),
+				barlib.OnMiddle(func(barproto.Event) {
 					if niri {
 						nirimsg("action", "spawn", "--", "gnome-disks")
 					} else {
 						i3msg(`exec --no-startup-id gnome-disks`)
 					}
-					continue
-				case 3:
+				}),
+				barlib.OnRight(func(barproto.Event) {
 					expanded = !expanded
+					i.State().Set("expanded", expanded)
 					isEvent = true
+				}),
+			)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					render(barproto.Block{
+						FullText:  "?",
+						Color:     i.Theme().Bad,
+						Separator: true,
+					})
+				} else {
+					i.Theme().Err(render, err)
+				}
+				return
+			}
+			var (
+				available = stat.Bavail * uint64(stat.Bsize)
+				total     = stat.Blocks * uint64(stat.Bsize)
+			)
+			block := barproto.Block{
+				FullText:  humanize.IBytes(available),
+				Separator: true,
+			}
+			if expanded {
+				block.FullText += " / " + humanize.IBytes(total)
+			}
+			var (
+				frac       float64
+				thresholds barlib.Thresholds
+			)
+			if total != 0 {
+				frac = 1 - float64(available)/float64(total)
+				if c.Threshold != 0 {
+					thresholds = barlib.Thresholds{{
+						Value: 1 - float64(c.Threshold)/float64(total),
+						Color: c.ThresholdColor,
+					}}
+					if thresholds[0].Color == 0 {
+						thresholds[0].Color = i.Theme().Degraded
+					}
+				}
+			}
+			if c.Bar != 0 {
+				i.Theme().Gauge(render, block, frac, c.Bar, thresholds)
+			} else {
+				block.Color = thresholds.Color(frac)
+				render(block)
+			}
+		})
+		for isEvent = false; ; {
+			select {
+			case <-ticker:
+			case <-signal:
+				isEvent = true
+			case <-i.Context().Done():
+				return i.Context().Err()
+			case fn := <-i.Handle():
+				if fn(); !isEvent {
+					continue // doesn't need to be refreshed
 				}
 			}
 			break
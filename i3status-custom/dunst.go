@@ -9,6 +9,7 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type Dunst struct {
@@ -16,36 +17,24 @@ type Dunst struct {
 
 func (c Dunst) Run(i barlib.Instance) error {
 	// scroll up to show, down to hide, click for dnd
-	conn, err := dbus.SessionBus()
+	bus, err := dbusutil.SessionBus()
 	if err != nil {
 		return err
 	}
-	obj := conn.Object("org.freedesktop.Notifications", dbus.ObjectPath("/org/freedesktop/Notifications"))
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-		dbus.WithMatchArg(0, "org.freedesktop.Notifications"),
-	); err != nil {
-		return err
-	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath(obj.Path()),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "org.dunstproject.cmd0"),
-	); err != nil {
+	defer bus.Release()
+
+	props, err := bus.Properties("org.freedesktop.Notifications", "/org/freedesktop/Notifications", "org.dunstproject.cmd0")
+	if err != nil {
 		return err
 	}
-	// note: https://github.com/dunst-project/dunst/issues/765
-	ch := make(chan *dbus.Signal, 6)
-	conn.Signal(ch)
+	defer props.Close()
+
+	obj := props.Object()
 	for {
 		var (
 			paused bool
 		)
-		if err := obj.StoreProperty("org.dunstproject.cmd0.paused", &paused); err != nil {
+		if err := props.Store("paused", &paused); err != nil {
 			return err
 		}
 		i.Update(false, func(render barlib.Renderer) {
@@ -53,7 +42,7 @@ func (c Dunst) Run(i barlib.Instance) error {
 				render(barproto.Block{
 					FullText:  "\uf1f6",
 					Separator: true,
-					Color:     0xFFFF00FF,
+					Color:     i.Theme().Idle,
 				})
 			} else {
 				render(barproto.Block{
@@ -61,29 +50,25 @@ func (c Dunst) Run(i barlib.Instance) error {
 					MinWidthString: "\uf1f6",
 					Align:          "center",
 					Separator:      true,
-					Color:          0x87CEEBFF,
+					Color:          i.Theme().Accent,
 				})
 			}
 		})
 		for {
 			select {
-			case sig := <-ch:
-				switch {
-				case sig.Sender == "org.freedesktop.DBus" && sig.Path == "/org/freedesktop/DBus" && sig.Name == "org.freedesktop.DBus.NameOwnerChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "org.freedesktop.Notifications" {
-						continue
-					}
-				case sig.Path == obj.Path() && sig.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "org.dunstproject.cmd0" {
-						continue
-					}
-				}
+			case <-props.Changed():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				case 1:
 					if err := obj.SetProperty("org.dunstproject.cmd0.paused", dbus.MakeVariant(!paused)); err != nil {
 						return err
 					}
+					// note: https://github.com/dunst-project/dunst/issues/765
+					if err := props.Refresh(); err != nil {
+						return err
+					}
 				case 2:
 					i3msg(`exec --no-startup-id dunstctl action`)
 				case 4:
@@ -73,7 +73,7 @@ func (c Interfaces) Run(i barlib.Instance) error {
 			slices.Sort(ifaces)
 			i.Update(isEvent, func(render barlib.Renderer) {
 				if err != nil {
-					render.Err(err)
+					i.Theme().Err(render, err)
 					return
 				}
 				for _, s := range ifaces {
@@ -85,7 +85,7 @@ func (c Interfaces) Run(i barlib.Instance) error {
 							Instance:            s.Name,
 							FullText:            fmt.Sprintf(" %s/s↑ %s/s↓", humanize.IBytes(uint64(s.ThroughputTx)), humanize.IBytes(uint64(s.ThroughputRx))),
 							Separator:           false,
-							SeparatorBlockWidth: 6,
+							SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 						})
 					case 2:
 						var ip string
@@ -98,14 +98,14 @@ func (c Interfaces) Run(i barlib.Instance) error {
 							Instance:            s.Name,
 							FullText:            ip,
 							Separator:           false,
-							SeparatorBlockWidth: 6,
+							SeparatorBlockWidth: i.Theme().SeparatorBlockWidth,
 						})
 					}
 					block := barproto.Block{
 						Instance:  s.Name,
 						FullText:  s.Name,
 						Separator: true,
-						Color:     0x00FF00FF,
+						Color:     i.Theme().Good,
 					}
 					if c.Icon != nil {
 						if x := c.Icon(s.Name); x != 0 {
@@ -120,6 +120,8 @@ func (c Interfaces) Run(i barlib.Instance) error {
 			select {
 			case <-ticker:
 			case <-i.Stopped():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				default:
@@ -9,6 +9,7 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type Mako struct {
@@ -16,30 +17,19 @@ type Mako struct {
 
 func (c Mako) Run(i barlib.Instance) error {
 	// scroll up to show, down to hide, click for dnd
-	conn, err := dbus.SessionBus()
+	bus, err := dbusutil.SessionBus()
 	if err != nil {
 		return err
 	}
-	obj := conn.Object("org.freedesktop.Notifications", dbus.ObjectPath("/fr/emersion/Mako"))
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-		dbus.WithMatchArg(0, "org.freedesktop.Notifications"),
-	); err != nil {
-		return err
-	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath(obj.Path()),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "fr.emersion.Mako"),
-	); err != nil {
+	defer bus.Release()
+
+	svc, err := bus.WatchService("org.freedesktop.Notifications")
+	if err != nil {
 		return err
 	}
-	ch := make(chan *dbus.Signal, 6)
-	conn.Signal(ch)
+	defer svc.Close()
+
+	obj := bus.Conn().Object(svc.Name(), "/fr/emersion/Mako")
 	for {
 		i.Update(false, func(render barlib.Renderer) {
 			render(barproto.Block{
@@ -49,17 +39,9 @@ func (c Mako) Run(i barlib.Instance) error {
 		})
 		for {
 			select {
-			case sig := <-ch:
-				switch {
-				case sig.Sender == "org.freedesktop.DBus" && sig.Path == "/org/freedesktop/DBus" && sig.Name == "org.freedesktop.DBus.NameOwnerChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "org.freedesktop.Notifications" {
-						continue
-					}
-				case sig.Path == obj.Path() && sig.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "fr.emersion.Mako" {
-						continue
-					}
-				}
+			case <-svc.Changed():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				case 2:
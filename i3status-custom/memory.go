@@ -1,8 +1,8 @@
 // # memory
 //
 // Polls memory usage from procfs at the configured interval. Shows used memory
-// similar to the "free" command. Starts htop sorted by memory usage on
-// middle-click.
+// similar to the "free" command, optionally with a usage bar. Starts htop
+// sorted by memory usage on middle-click.
 package main
 
 import (
@@ -21,56 +21,72 @@ import (
 type Memory struct {
 	Interval       time.Duration
 	Threshold      uint64
-	ThresholdColor uint32
+	ThresholdColor uint32 // 0 for the theme's degraded color
+	Bar            int    // usage bar width (0 to disable)
 }
 
 func (c Memory) Run(i barlib.Instance) error {
 	var expanded bool
+	i.State().Get("expanded", &expanded)
 	for ticker, isEvent := i.Tick(c.Interval), false; ; {
-		if !i.IsStopped() {
-			stats, err := getMemInfo()
-			i.Update(isEvent, func(render barlib.Renderer) {
-				if err != nil {
-					render(barproto.Block{
-						FullText:  err.Error(),
-						Urgent:    true,
-						Separator: true,
-					})
-					return
-				}
-				used := stats.MemTotal - stats.MemFree - stats.Buffers - stats.Cached
-				block := barproto.Block{
-					FullText:  humanize.IBytes(used),
-					Separator: true,
-				}
-				if expanded {
-					block.FullText += " / " + humanize.IBytes(stats.MemTotal)
-				}
-				if used+c.Threshold >= stats.MemTotal {
-					block.Color = c.ThresholdColor
-				}
-				render(block)
-			})
-		}
-		for {
-			select {
-			case <-ticker:
-			case <-i.Stopped():
-			case event := <-i.Event():
-				switch event.Button {
-				default:
-					continue
-				case 1:
+		stats, err := getMemInfo()
+		i.Update(isEvent, func(render barlib.Renderer) {
+			i.Attach("",
+				barlib.OnClick(func(barproto.Event) {
 					isEvent = true
-				case 2:
+				}),
+				barlib.OnMiddle(func(barproto.Event) {
 					if niri {
 						nirimsg("action", "spawn", "--", "foot", "--app-id=htop", "--title=htop", "htop", "--sort-key=PERCENT_MEM")
 					} else {
 						i3msg(`exec --no-startup-id xfce4-terminal --hide-scrollbar --hide-menubar --dynamic-title-mode none --title htop -e 'htop --sort-key=PERCENT_MEM'`)
 					}
-				case 3:
+				}),
+				barlib.OnRight(func(barproto.Event) {
 					expanded = !expanded
-				}
+					i.State().Set("expanded", expanded)
+				}),
+			)
+			if err != nil {
+				render(barproto.Block{
+					FullText:  err.Error(),
+					Urgent:    true,
+					Separator: true,
+				})
+				return
+			}
+			used := stats.MemTotal - stats.MemFree - stats.Buffers - stats.Cached
+			block := barproto.Block{
+				FullText:  humanize.IBytes(used),
+				Separator: true,
+			}
+			if expanded {
+				block.FullText += " / " + humanize.IBytes(stats.MemTotal)
+			}
+			var (
+				frac       = float64(used) / float64(stats.MemTotal)
+				thresholds = barlib.Thresholds{{
+					Value: (float64(stats.MemTotal) - float64(c.Threshold)) / float64(stats.MemTotal),
+					Color: c.ThresholdColor,
+				}}
+			)
+			if thresholds[0].Color == 0 {
+				thresholds[0].Color = i.Theme().Degraded
+			}
+			if c.Bar != 0 {
+				i.Theme().Gauge(render, block, frac, c.Bar, thresholds)
+			} else {
+				block.Color = thresholds.Color(frac)
+				render(block)
+			}
+		})
+		for {
+			select {
+			case <-ticker:
+			case <-i.Context().Done():
+				return i.Context().Err()
+			case fn := <-i.Handle():
+				fn()
 			}
 			break
 		}
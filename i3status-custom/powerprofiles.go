@@ -9,43 +9,33 @@ import (
 	"github.com/godbus/dbus/v5"
 	"github.com/pgaskin/barlib"
 	"github.com/pgaskin/barlib/barproto"
+	"github.com/pgaskin/barlib/dbusutil"
 )
 
 type PowerProfiles struct {
 }
 
 func (c PowerProfiles) Run(i barlib.Instance) error {
-	conn, err := dbus.SystemBus()
+	bus, err := dbusutil.SystemBus()
 	if err != nil {
 		return err
 	}
-	obj := conn.Object("net.hadess.PowerProfiles", dbus.ObjectPath("/net/hadess/PowerProfiles"))
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-		dbus.WithMatchArg(0, "net.hadess.PowerProfiles"),
-	); err != nil {
-		return err
-	}
-	if err := conn.AddMatchSignal(
-		dbus.WithMatchObjectPath(obj.Path()),
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchMember("PropertiesChanged"),
-		dbus.WithMatchArg(0, "net.hadess.PowerProfiles"),
-	); err != nil {
+	defer bus.Release()
+
+	props, err := bus.Properties("net.hadess.PowerProfiles", "/net/hadess/PowerProfiles", "net.hadess.PowerProfiles")
+	if err != nil {
 		return err
 	}
-	ch := make(chan *dbus.Signal, 6)
-	conn.Signal(ch)
+	defer props.Close()
+
+	obj := props.Object()
 	for {
 		var (
 			activeProfile string
 			profiles      []map[string]dbus.Variant
 		)
-		if err := obj.StoreProperty("net.hadess.PowerProfiles.ActiveProfile", &activeProfile); err == nil {
-			if err := obj.StoreProperty("net.hadess.PowerProfiles.Profiles", &profiles); err != nil {
+		if err := props.Store("ActiveProfile", &activeProfile); err == nil {
+			if err := props.Store("Profiles", &profiles); err != nil {
 				return err
 			}
 		}
@@ -58,10 +48,10 @@ func (c PowerProfiles) Run(i barlib.Instance) error {
 				switch activeProfile {
 				case "performance":
 					block.FullText = "\uf625"
-					block.Color = 0xFF5C00FF
+					block.Color = i.Theme().Boost
 				case "power-saver":
 					block.FullText = "\uf300"
-					block.Color = 0xFFFF00FF
+					block.Color = i.Theme().Degraded
 				case "balanced":
 					block.FullText = "\uf24e"
 				}
@@ -70,17 +60,9 @@ func (c PowerProfiles) Run(i barlib.Instance) error {
 		})
 		for {
 			select {
-			case sig := <-ch:
-				switch {
-				case sig.Sender == "org.freedesktop.DBus" && sig.Path == "/org/freedesktop/DBus" && sig.Name == "org.freedesktop.DBus.NameOwnerChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "net.hadess.PowerProfiles" {
-						continue
-					}
-				case sig.Path == obj.Path() && sig.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" && len(sig.Body) == 3:
-					if sig.Body[0].(string) != "net.hadess.PowerProfiles" {
-						continue
-					}
-				}
+			case <-props.Changed():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				case 1:
@@ -1,8 +1,9 @@
 // # pulseaudio
 //
 // Controls sink/source volume/mute/default using the PulseAudio native API. Has
-// reasonable thresholds for the volume step. Starts pavucontrol with the
-// sink/source tab selected on middle-click.
+// reasonable thresholds for the volume step, which increases when scrolling
+// quickly. Starts pavucontrol with the sink/source tab selected on
+// middle-click.
 package main
 
 import (
@@ -36,6 +37,7 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 	var (
 		snkExp, srcExp bool
 		snkSel, srcSel string
+		gestures       = barlib.RecognizeGestures(i, barlib.GestureOptions{})
 	)
 	for {
 		if !cl.Connected() {
@@ -118,9 +120,9 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 						FullText: " ",
 					}
 					if s.Muted {
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					} else {
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					}
 					render(block)
 				}
@@ -130,9 +132,9 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 						FullText: s.Description + " ",
 					}
 					if snkDef == s.Name {
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					} else {
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					}
 					render(block)
 				}
@@ -144,10 +146,10 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 					}
 					if s.Muted {
 						block.FullText += "-"
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					} else {
 						block.FullText += "%"
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					}
 					render(block)
 				}
@@ -161,9 +163,9 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 						Separator: false,
 					}
 					if s.Muted {
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					} else {
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					}
 					render(block)
 				}
@@ -173,9 +175,9 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 						FullText: s.Description + " ",
 					}
 					if srcDef == s.Name {
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					} else {
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					}
 					render(block)
 				}
@@ -187,10 +189,10 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 					}
 					if s.Muted {
 						block.FullText += "-"
-						block.Color = 0xFFFF00FF
+						block.Color = i.Theme().Degraded
 					} else {
 						block.FullText += "%"
-						block.Color = 0x00FF00FF
+						block.Color = i.Theme().Good
 					}
 					render(block)
 				}
@@ -208,7 +210,12 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 					}
 					break
 				}
-			case event := <-i.Event():
+			case <-i.Context().Done():
+				return i.Context().Err()
+			case event := <-gestures:
+				if event.Kind == barlib.Hold {
+					continue // already handled as a click when pressed
+				}
 				if !cl.Connected() {
 					return fmt.Errorf("disconnected")
 				}
@@ -243,7 +250,7 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 								snkSel = snk[snkIdx].Name
 								goto render // re-render without getting new data
 							} else {
-								err = cl.SetSinkVolume(s.Name, min(max(float32(snkVol[snkIdx]+1)/100, 0), 1.25))
+								err = cl.SetSinkVolume(s.Name, min(max(float32(snkVol[snkIdx]+event.Step(1))/100, 0), 1.25))
 							}
 						case 5:
 							if event.Instance == "snk_sel" {
@@ -253,7 +260,7 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 								snkSel = snk[snkIdx].Name
 								goto render // re-render without getting new data
 							} else {
-								err = cl.SetSinkVolume(s.Name, min(max(float32(snkVol[snkIdx]-1)/100, 0), 1.25))
+								err = cl.SetSinkVolume(s.Name, min(max(float32(snkVol[snkIdx]-event.Step(1))/100, 0), 1.25))
 							}
 						}
 					}
@@ -292,7 +299,7 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 								srcSel = src[srcIdx].Name
 								goto render // re-render without getting new data
 							} else {
-								err = cl.SetSourceVolume(s.Name, min(max(float32(srcVol[srcIdx]+1)/100, 0), 1.25))
+								err = cl.SetSourceVolume(s.Name, min(max(float32(srcVol[srcIdx]+event.Step(1))/100, 0), 1.25))
 							}
 						case 5:
 							if event.Instance == "src_sel" {
@@ -308,7 +315,7 @@ func (c PulseAudio) Run(i barlib.Instance) error {
 								srcSel = src[srcIdx].Name
 								goto render // re-render without getting new data
 							} else {
-								err = cl.SetSourceVolume(s.Name, min(max(float32(srcVol[srcIdx]-1)/100, 0), 1.25))
+								err = cl.SetSourceVolume(s.Name, min(max(float32(srcVol[srcIdx]-event.Step(1))/100, 0), 1.25))
 							}
 						}
 					}
@@ -8,8 +8,6 @@ package main
 
 import (
 	"fmt"
-	"log/slog"
-	"os"
 	"strconv"
 	"time"
 
@@ -37,10 +35,7 @@ func (c Redshift) Run(i barlib.Instance) error {
 	if c.TemperatureNight == 0 {
 		c.TemperatureNight = 4500
 	}
-	m, fatal, err := redshift.New(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level:     slog.LevelInfo,
-		AddSource: true,
-	})))
+	m, fatal, err := redshift.New(i.Logger())
 	if err != nil {
 		return err
 	}
@@ -50,6 +45,10 @@ func (c Redshift) Run(i barlib.Instance) error {
 		override    bool
 		temperature redshift.Temperature
 	)
+	i.State().Get("disabled", &disabled)
+	if i.State().Get("temperature", &temperature) {
+		override = true
+	}
 	for ticker, isEvent := i.Tick(time.Second*15), false; ; {
 		if !override {
 			temperature = redshift.Solar(time.Now(), c.Latitude, c.Longitude, c.ElevationNight, c.ElevationDay, c.TemperatureNight, c.TemperatureDay)
@@ -74,9 +73,9 @@ func (c Redshift) Run(i barlib.Instance) error {
 				block.FullText = strconv.Itoa(int(temperature)) + "K"
 			}
 			if disabled {
-				block.Color = 0xFFFF00FF
+				block.Color = i.Theme().Degraded
 			} else if override {
-				block.Color = 0x00FF00FF
+				block.Color = i.Theme().Good
 			}
 			render(block)
 		})
@@ -87,6 +86,8 @@ func (c Redshift) Run(i barlib.Instance) error {
 				return err
 			case <-ticker:
 			case <-i.Stopped():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				default:
@@ -106,6 +107,12 @@ func (c Redshift) Run(i barlib.Instance) error {
 					override = true
 					temperature -= 50
 				}
+				i.State().Set("disabled", disabled)
+				if override {
+					i.State().Set("temperature", temperature)
+				} else {
+					i.State().Delete("temperature")
+				}
 			}
 			break
 		}
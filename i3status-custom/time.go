@@ -1,7 +1,7 @@
 // # time
 //
-// Renders the current time at the configured interval using the specified
-// stdlib layout.
+// Renders the current time at the configured interval (aligned to the wall
+// clock) using the specified stdlib layout.
 package main
 
 import (
@@ -19,21 +19,20 @@ type Time struct {
 }
 
 func (c Time) Run(i barlib.Instance) error {
-	for ticker := i.Tick(c.Interval); ; {
-		if !i.IsStopped() {
-			now := time.Now()
-			i.Update(false, func(render barlib.Renderer) {
-				render(barproto.Block{
-					FullText:  now.Format(c.LayoutFull),
-					ShortText: now.Format(c.LayoutShort),
-					Color:     c.Color,
-					Separator: true,
-				})
+	for ticker := i.TickAligned(c.Interval); ; {
+		now := time.Now()
+		i.Update(false, func(render barlib.Renderer) {
+			render(barproto.Block{
+				FullText:  now.Format(c.LayoutFull),
+				ShortText: now.Format(c.LayoutShort),
+				Color:     c.Color,
+				Separator: true,
 			})
-		}
+		})
 		select {
 		case <-ticker:
-		case <-i.Stopped():
+		case <-i.Context().Done():
+			return i.Context().Err()
 		}
 	}
 }
@@ -29,6 +29,7 @@ func (c WiFi) Run(i barlib.Instance) error {
 	if err != nil {
 		return err
 	}
+	defer cl.Close()
 	type State struct {
 		SSID         string
 		BSSID        net.HardwareAddr
@@ -91,7 +92,7 @@ func (c WiFi) Run(i barlib.Instance) error {
 					return
 				}
 				if err != nil {
-					render.Err(err)
+					i.Theme().Err(render, err)
 				}
 				for _, iface := range ifaces {
 					if cur, ok := state[iface.Index]; ok {
@@ -106,7 +107,7 @@ func (c WiFi) Run(i barlib.Instance) error {
 							}
 							render(barproto.Block{
 								FullText:  fmt.Sprintf("%s %.1fG %ddBm", cur.SSID, float64(cur.Frequency)/1000, cur.Signal),
-								Color:     0x00FF00FF,
+								Color:     i.Theme().Good,
 								Separator: true,
 							})
 						}
@@ -118,6 +119,8 @@ func (c WiFi) Run(i barlib.Instance) error {
 			select {
 			case <-ticker:
 			case <-i.Stopped():
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				default:
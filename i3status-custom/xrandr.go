@@ -29,6 +29,7 @@ func (c XRandR) Run(i barlib.Instance) error {
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 	if err := randr.Init(conn); err != nil {
 		return err
 	}
@@ -37,17 +38,26 @@ func (c XRandR) Run(i barlib.Instance) error {
 		return err
 	}
 	ch := make(chan error, 1)
+	ctx := i.Context()
 	go func() {
 		var err error
 		for err == nil {
-			_, err = conn.WaitForEvent()
-			ch <- err
+			var ev xgb.Event
+			if ev, err = conn.WaitForEvent(); ev == nil && err == nil {
+				err = fmt.Errorf("connection closed")
+			}
+			select {
+			case ch <- err:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	var (
 		layoutSelecting bool
 		layoutSelection string
 	)
+	layoutSelecting = i.State().Get("layout", &layoutSelection)
 	for isEvent := false; ; {
 		// this logic intentionally supports a limited set of two-monitor
 		// configurations
@@ -328,7 +338,7 @@ func (c XRandR) Run(i barlib.Instance) error {
 			}
 			apply = func(layout layoutInfo) error {
 				// this is much more reliable; it's somewhat complicated, and we only do it when changing, so it's okay that it's a bit inefficient
-				cmd := exec.Command("xrandr")
+				cmd := exec.CommandContext(i.Context(), "xrandr")
 				for _, crtc := range []crtcInfo{layout.Pri, layout.Sec} {
 					cmd.Args = append(cmd.Args, "--output", "0x"+strconv.FormatUint(uint64(crtc.O), 16))
 					if crtc.E {
@@ -398,12 +408,17 @@ func (c XRandR) Run(i barlib.Instance) error {
 		}
 
 	render:
+		if layoutSelecting {
+			i.State().Set("layout", layoutSelection)
+		} else {
+			i.State().Delete("layout")
+		}
 		i.Update(isEvent, func(render barlib.Renderer) {
 			var (
 				isActive bool
 				isPreset bool
 				preset   = "UNK"
-				color    = uint32(0x00FF00FF)
+				color    = i.Theme().Good
 			)
 			if len(outputs) != 0 {
 				var b strings.Builder
@@ -427,7 +442,7 @@ func (c XRandR) Run(i barlib.Instance) error {
 				color = 0
 			}
 			if isPreset && !isActive {
-				color = 0xFFFF00FF
+				color = i.Theme().Degraded
 			}
 			if swap != nil {
 				render(barproto.Block{
@@ -448,6 +463,8 @@ func (c XRandR) Run(i barlib.Instance) error {
 				if err != nil {
 					return err
 				}
+			case <-i.Context().Done():
+				return i.Context().Err()
 			case event := <-i.Event():
 				switch event.Button {
 				default:
@@ -0,0 +1,386 @@
+package barlib
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Output formats the bar for a specific status bar or terminal.
+type Output interface {
+	// AppendHeader appends the data to write before the first status line.
+	AppendHeader(b []byte, init barproto.Init) []byte
+
+	// AppendStatus appends a status line containing the provided blocks.
+	AppendStatus(b []byte, blocks []barproto.Block) []byte
+
+	// ParseEvent parses a line read from stdin. If the line should be
+	// ignored, ok is false. If the line is invalid, an error is returned.
+	ParseEvent(line []byte) (event barproto.Event, ok bool, err error)
+}
+
+// buttonsOutput is implemented by outputs which add click areas, so the bar
+// can limit them to the buttons handled by each block (a bitmask of buttons).
+type buttonsOutput interface {
+	appendStatus(b []byte, blocks []barproto.Block, buttons func(barproto.Block) uint32) []byte
+}
+
+// I3barOutput writes the i3bar JSON protocol. This is the default.
+type I3barOutput struct{}
+
+func (I3barOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	b = init.AppendJSON(b)
+	b = append(b, "\n[[]\n"...)
+	return b
+}
+
+func (I3barOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	b = append(b, ",["...)
+	for i, block := range blocks {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = block.AppendJSON(b)
+	}
+	b = append(b, "]\n"...)
+	return b
+}
+
+func (I3barOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) != 0 && (line[0] == '[' || line[0] == ',') {
+		line = line[1:]
+	}
+	if len(line) == 0 {
+		return barproto.Event{}, false, nil
+	}
+	if line[0] != '{' || line[len(line)-1] != '}' {
+		return barproto.Event{}, false, fmt.Errorf("invalid event line %q", line)
+	}
+	var event barproto.Event
+	if err := event.UnmarshalJSON(line); err != nil {
+		return barproto.Event{}, false, err
+	}
+	return event, true, nil
+}
+
+// TextOutput writes plain text lines. Click events are not supported.
+type TextOutput struct {
+	Separator string // between blocks with Separator set (default " | ")
+	Short     bool   // use ShortText if set
+}
+
+func (TextOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	return b
+}
+
+func (o TextOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	b = appendText(b, blocks, o.Short, o.Separator, nil, nil, nil)
+	b = append(b, '\n')
+	return b
+}
+
+func (TextOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	return barproto.Event{}, false, nil
+}
+
+// ANSIOutput writes lines with 24-bit ANSI terminal colors. Click events are
+// not supported.
+type ANSIOutput struct {
+	Separator string // between blocks with Separator set (default " | ")
+	Short     bool   // use ShortText if set
+	Overwrite bool   // overwrite the current line instead of writing a new one
+}
+
+func (ANSIOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	return b
+}
+
+func (o ANSIOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	if o.Overwrite {
+		b = append(b, "\r\x1b[K"...)
+	}
+	b = appendText(b, blocks, o.Short, o.Separator, nil, func(b []byte, block barproto.Block) []byte {
+		if block.Urgent {
+			b = append(b, "\x1b[1m"...)
+		}
+		if v := block.Color; v != 0 {
+			b = append(b, "\x1b[38;2;"...)
+			b = appendRGB(b, v, ';')
+			b = append(b, 'm')
+		}
+		if v := block.Background; v != 0 {
+			b = append(b, "\x1b[48;2;"...)
+			b = appendRGB(b, v, ';')
+			b = append(b, 'm')
+		}
+		return b
+	}, func(b []byte, block barproto.Block) []byte {
+		if block.Urgent || block.Color != 0 || block.Background != 0 {
+			b = append(b, "\x1b[0m"...)
+		}
+		return b
+	})
+	if !o.Overwrite {
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func (ANSIOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	return barproto.Event{}, false, nil
+}
+
+// TmuxOutput writes lines for use in the tmux status line with a command like
+// #(i3status-custom), where the most recent line is displayed. Click events are
+// not supported.
+type TmuxOutput struct {
+	Separator string // between blocks with Separator set (default " | ")
+	Short     bool   // use ShortText if set
+}
+
+func (TmuxOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	return b
+}
+
+func (o TmuxOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	text := func(block barproto.Block, short bool) string {
+		return strings.ReplaceAll(textOf(block, short), "#", "##")
+	}
+	b = appendText(b, blocks, o.Short, strings.ReplaceAll(o.Separator, "#", "##"), text, func(b []byte, block barproto.Block) []byte {
+		if block.Color != 0 || block.Background != 0 || block.Urgent {
+			b = append(b, "#["...)
+			var comma bool
+			if v := block.Color; v != 0 {
+				b = append(b, "fg=#"...)
+				b = appendHex(b, v>>8, 6)
+				comma = true
+			}
+			if v := block.Background; v != 0 {
+				if comma {
+					b = append(b, ',')
+				}
+				b = append(b, "bg=#"...)
+				b = appendHex(b, v>>8, 6)
+				comma = true
+			}
+			if block.Urgent {
+				if comma {
+					b = append(b, ',')
+				}
+				b = append(b, "bold"...)
+			}
+			b = append(b, ']')
+		}
+		return b
+	}, func(b []byte, block barproto.Block) []byte {
+		if block.Color != 0 || block.Background != 0 || block.Urgent {
+			b = append(b, "#[default]"...)
+		}
+		return b
+	})
+	b = append(b, '\n')
+	return b
+}
+
+func (TmuxOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	return barproto.Event{}, false, nil
+}
+
+// LemonbarOutput writes lines for lemonbar (or polybar using ipc or the
+// script module with tail enabled) using its formatting tags, with click areas
+// for each block.
+//
+// By default, lemonbar writes the command for a click area to stdout, so its
+// stdout should be connected to stdin for click events to work. For bars which
+// execute the commands directly (like polybar), Command should return a
+// command which sends the event to the control socket using barlibctl.
+//
+// The name and instance in the default command are URL-encoded so they can't
+// contain characters with special meaning to lemonbar. Colons in commands are
+// escaped, but since the formatting tag ends at the first closing brace, custom
+// commands must not contain one. If Command returns an empty string, no click
+// area is added for the button.
+//
+// When used by the bar, click areas are only added for the buttons handled by
+// each block (all of them if the module reads [Instance.Event] directly).
+// Since lemonbar only allows 10 click areas by default, its -a option should
+// usually be raised to up to 5 per block.
+type LemonbarOutput struct {
+	Separator string                      // between blocks with Separator set (default " | ")
+	Short     bool                        // use ShortText if set
+	Command   func(barproto.Event) string // generates click commands (default "barlib name button instance")
+}
+
+func (LemonbarOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	return b
+}
+
+func (o LemonbarOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	return o.appendStatus(b, blocks, nil)
+}
+
+func (o LemonbarOutput) appendStatus(b []byte, blocks []barproto.Block, buttons func(barproto.Block) uint32) []byte {
+	text := func(block barproto.Block, short bool) string {
+		return strings.ReplaceAll(textOf(block, short), "%", "%%")
+	}
+	var areas int // number of click areas opened for the current block
+	b = appendText(b, blocks, o.Short, strings.ReplaceAll(o.Separator, "%", "%%"), text, func(b []byte, block barproto.Block) []byte {
+		handled := ^uint32(0)
+		if buttons != nil {
+			handled = buttons(block)
+		}
+		areas = 0
+		for button := 1; button <= 5; button++ {
+			if handled&(1<<button) == 0 {
+				continue
+			}
+			event := barproto.Event{
+				Name:     block.Name,
+				Instance: block.Instance,
+				Button:   button,
+			}
+			var cmd string
+			if o.Command != nil {
+				cmd = o.Command(event)
+			} else {
+				cmd = "barlib " + url.QueryEscape(event.Name) + " " + strconv.Itoa(event.Button) + " " + url.QueryEscape(event.Instance)
+			}
+			if cmd == "" {
+				continue
+			}
+			b = append(b, "%{A"...)
+			b = strconv.AppendInt(b, int64(button), 10)
+			b = append(b, ':')
+			b = append(b, lemonbarEscaper.Replace(cmd)...)
+			b = append(b, ":}"...)
+			areas++
+		}
+		if v := block.Color; v != 0 {
+			b = append(b, "%{F#"...)
+			b = appendHex(b, v>>8|v<<24, 8)
+			b = append(b, '}')
+		}
+		if v := block.Background; v != 0 {
+			b = append(b, "%{B#"...)
+			b = appendHex(b, v>>8|v<<24, 8)
+			b = append(b, '}')
+		}
+		if block.Urgent {
+			b = append(b, "%{R}"...)
+		}
+		return b
+	}, func(b []byte, block barproto.Block) []byte {
+		if block.Urgent {
+			b = append(b, "%{R}"...)
+		}
+		if block.Background != 0 {
+			b = append(b, "%{B-}"...)
+		}
+		if block.Color != 0 {
+			b = append(b, "%{F-}"...)
+		}
+		for range areas {
+			b = append(b, "%{A}"...)
+		}
+		return b
+	})
+	b = append(b, '\n')
+	return b
+}
+
+func (LemonbarOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return barproto.Event{}, false, nil
+	}
+	rest, ok := bytes.CutPrefix(line, []byte("barlib "))
+	if !ok {
+		return barproto.Event{}, false, fmt.Errorf("invalid command %q", line)
+	}
+	name, rest, _ := bytes.Cut(rest, []byte{' '})
+	button, instance, _ := bytes.Cut(rest, []byte{' '})
+	n, err := strconv.Atoi(string(button))
+	if err != nil {
+		return barproto.Event{}, false, fmt.Errorf("invalid command %q: invalid button", line)
+	}
+	event := barproto.Event{Button: n}
+	if event.Name, err = url.QueryUnescape(string(name)); err != nil {
+		return barproto.Event{}, false, fmt.Errorf("invalid command %q: invalid name", line)
+	}
+	if event.Instance, err = url.QueryUnescape(string(instance)); err != nil {
+		return barproto.Event{}, false, fmt.Errorf("invalid command %q: invalid instance", line)
+	}
+	return event, true, nil
+}
+
+// lemonbarEscaper escapes colons in click commands, which would otherwise end
+// the command.
+var lemonbarEscaper = strings.NewReplacer(":", "\\:")
+
+// appendText appends the text of blocks, separating them like i3bar would,
+// calling start and end around each block if not nil. If text is nil, textOf
+// is used. The separator is not passed through text.
+func appendText(b []byte, blocks []barproto.Block, short bool, separator string, text func(barproto.Block, bool) string, start, end func([]byte, barproto.Block) []byte) []byte {
+	if text == nil {
+		text = textOf
+	}
+	if separator == "" {
+		separator = " | "
+	}
+	for i, block := range blocks {
+		if start != nil {
+			b = start(b, block)
+		}
+		b = append(b, text(block, short)...)
+		if end != nil {
+			b = end(b, block)
+		}
+		if i != len(blocks)-1 {
+			switch {
+			case block.Separator:
+				b = append(b, separator...)
+			case block.SeparatorBlockWidth != 0 && block.SeparatorBlockWidth != barproto.ZeroSeparatorBlockWidth:
+				b = append(b, ' ')
+			}
+		}
+	}
+	return b
+}
+
+var pangoTag = regexp.MustCompile(`<[^>]*>`)
+
+// textOf gets the plain text of a block.
+func textOf(block barproto.Block, short bool) string {
+	s := block.FullText
+	if short && block.ShortText != "" {
+		s = block.ShortText
+	}
+	if block.Pango {
+		s = html.UnescapeString(pangoTag.ReplaceAllString(s, ""))
+	}
+	return s
+}
+
+func appendRGB(b []byte, rrggbbaa uint32, sep byte) []byte {
+	b = strconv.AppendUint(b, uint64(rrggbbaa>>24&0xFF), 10)
+	b = append(b, sep)
+	b = strconv.AppendUint(b, uint64(rrggbbaa>>16&0xFF), 10)
+	b = append(b, sep)
+	b = strconv.AppendUint(b, uint64(rrggbbaa>>8&0xFF), 10)
+	return b
+}
+
+func appendHex(b []byte, v uint32, digits int) []byte {
+	const hex = "0123456789ABCDEF"
+	for i := digits - 1; i >= 0; i-- {
+		b = append(b, hex[v>>(i*4)&0xF])
+	}
+	return b
+}
@@ -0,0 +1,103 @@
+package barlib
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestOutput(t *testing.T) {
+	blocks := []barproto.Block{
+		{FullText: "a#%", Name: "0", Instance: "x", Separator: true},
+		{FullText: "<b>b</b>&amp;", ShortText: "B", Name: "1", Color: 0x112233FF, Pango: true, SeparatorBlockWidth: -1},
+		{FullText: "c", Name: "2", Background: 0xAABBCCFF, Urgent: true},
+	}
+	for _, tc := range []struct {
+		Name   string
+		Output Output
+		Status string
+	}{
+		{"I3bar", I3barOutput{}, `,[{"full_text":"a#%","name":"0","instance":"x","separator":true},{"full_text":"<b>b</b>&amp;","short_text":"B","color":"#112233","name":"1","separator":false,"markup":"pango"},{"full_text":"c","name":"2","background":"#AABBCC","urgent":true,"separator":false,"separator_block_width":0}]` + "\n"},
+		{"Text", TextOutput{}, "a#% | b& c\n"},
+		{"TextShort", TextOutput{Short: true, Separator: "/"}, "a#%/B c\n"},
+		{"ANSI", ANSIOutput{Overwrite: true}, "\r\x1b[Ka#% | \x1b[38;2;17;34;51mb&\x1b[0m \x1b[1m\x1b[48;2;170;187;204mc\x1b[0m"},
+		{"Tmux", TmuxOutput{}, "a##% | #[fg=#112233]b&#[default] #[bg=#AABBCC,bold]c#[default]\n"},
+		{"Lemonbar", LemonbarOutput{Command: func(e barproto.Event) string {
+			if e.Button != 1 {
+				return ""
+			}
+			return "click:" + e.Name
+		}}, "%{A1:click\\:0:}a#%%%{A} | " +
+			"%{A1:click\\:1:}%{F#FF112233}b&%{F-}%{A} " +
+			"%{A1:click\\:2:}%{B#FFAABBCC}%{R}c%{R}%{B-}%{A}\n"},
+		{"Waybar", WaybarOutput{}, `{"text":"a#% | \u003cb\u003eb\u003c/b\u003e\u0026amp; c","tooltip":"a#%\n\u003cb\u003eb\u003c/b\u003e\u0026amp;\nc","class":["color-112233","urgent","background-aabbcc"]}` + "\n"},
+		{"WaybarShort", WaybarOutput{Short: true}, `{"text":"a#% | B c","tooltip":"a#%\n\u003cb\u003eb\u003c/b\u003e\u0026amp;\nc","class":["color-112233","urgent","background-aabbcc"]}` + "\n"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			orig := slices.Clone(blocks)
+			if act := string(tc.Output.AppendStatus(nil, blocks)); act != tc.Status {
+				t.Errorf("incorrect status line:\n\texp: %q\n\tact: %q", tc.Status, act)
+			}
+			if !slices.Equal(blocks, orig) {
+				t.Errorf("blocks were modified")
+			}
+		})
+	}
+	for _, tc := range []struct {
+		Name   string
+		Output Output
+		Line   string
+		Event  barproto.Event
+		OK     bool
+		Err    bool
+	}{
+		{"I3barStart", I3barOutput{}, "[", barproto.Event{}, false, false},
+		{"I3barFirst", I3barOutput{}, `[{"name":"0","instance":"x","button":1}`, barproto.Event{Name: "0", Instance: "x", Button: 1}, true, false},
+		{"I3bar", I3barOutput{}, `,{"name":"1","button":3}`, barproto.Event{Name: "1", Button: 3}, true, false},
+		{"I3barInvalid", I3barOutput{}, `,"x"`, barproto.Event{}, false, true},
+		{"Lemonbar", LemonbarOutput{}, "barlib 0 4 x y", barproto.Event{Name: "0", Instance: "x y", Button: 4}, true, false},
+		{"LemonbarEscaped", LemonbarOutput{}, "barlib a%3Ab 1 50%25+%7D", barproto.Event{Name: "a:b", Instance: "50% }", Button: 1}, true, false},
+		{"LemonbarInvalid", LemonbarOutput{}, "test", barproto.Event{}, false, true},
+		{"Text", TextOutput{}, "test", barproto.Event{}, false, false},
+	} {
+		t.Run("Parse"+tc.Name, func(t *testing.T) {
+			event, ok, err := tc.Output.ParseEvent([]byte(tc.Line))
+			if (err != nil) != tc.Err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.OK {
+				t.Errorf("expected ok=%t, got %t", tc.OK, ok)
+			}
+			if event.Name != tc.Event.Name || event.Instance != tc.Event.Instance || event.Button != tc.Event.Button {
+				t.Errorf("incorrect event: expected %+v, got %+v", tc.Event, event)
+			}
+		})
+	}
+}
+
+func TestLemonbarButtons(t *testing.T) {
+	var hs Handlers
+	hs.Add("x", OnClick(func(barproto.Event) {}), OnScroll(func(barproto.Event, int) {}))
+	hs.Add("y", OnRight(func(barproto.Event) {}))
+
+	blocks := []barproto.Block{
+		{FullText: "a", Name: "0", Instance: "x"},
+		{FullText: "b", Name: "0", Instance: "y"},
+		{FullText: "c", Name: "0", Instance: "z"},
+		{FullText: "d", Name: "1"},
+	}
+	act := string(LemonbarOutput{Command: func(e barproto.Event) string {
+		return e.Instance + strconv.Itoa(e.Button)
+	}}.appendStatus(nil, blocks, func(block barproto.Block) uint32 {
+		if block.Name == "1" {
+			return 1 << 2
+		}
+		return hs.buttons(block.Instance)
+	}))
+	exp := "%{A1:x1:}%{A4:x4:}%{A5:x5:}a%{A}%{A}%{A}%{A3:y3:}b%{A}c%{A2:2:}d%{A}\n"
+	if act != exp {
+		t.Errorf("incorrect status line:\n\texp: %q\n\tact: %q", exp, act)
+	}
+}
@@ -0,0 +1,69 @@
+package barlib
+
+import "time"
+
+// RestartPolicy controls how a module is restarted after Run returns an error.
+// The zero value waits for a click on the error block before restarting.
+type RestartPolicy struct {
+	// Auto restarts the module automatically after an exponential backoff
+	// instead of waiting for a click. Clicking the error block still restarts
+	// it immediately.
+	Auto bool
+
+	// Backoff is the delay before the first automatic restart, doubling for
+	// each consecutive failure. If zero, it is one second.
+	Backoff time.Duration
+
+	// MaxBackoff is the maximum delay between automatic restarts. If zero, it
+	// is one minute. If the module runs for longer than this before failing,
+	// the failure is not considered to be consecutive.
+	MaxBackoff time.Duration
+
+	// MaxAttempts is the maximum number of consecutive automatic restarts
+	// before falling back to waiting for a click. If zero, there is no limit.
+	MaxAttempts int
+
+	// Hide hides the module instead of showing the error while it is failed.
+	// Since hidden modules can't be clicked, this should usually be used with
+	// Auto and no MaxAttempts.
+	Hide bool
+}
+
+// delay returns the delay before the automatic restart after the specified
+// number of consecutive failures, or false if it should not be restarted
+// automatically.
+func (p RestartPolicy) delay(attempt int) (time.Duration, bool) {
+	if !p.Auto || (p.MaxAttempts != 0 && attempt >= p.MaxAttempts) {
+		return 0, false
+	}
+	d := p.Backoff
+	if d <= 0 {
+		d = time.Second
+	}
+	for range attempt {
+		if d *= 2; d >= p.maxBackoff() {
+			break
+		}
+	}
+	return min(d, p.maxBackoff()), true
+}
+
+func (p RestartPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return time.Minute
+	}
+	return p.MaxBackoff
+}
+
+type restartModule struct {
+	Module
+	policy RestartPolicy
+}
+
+// WithRestart wraps m to override the restart policy set in [Options].
+func WithRestart(m Module, policy RestartPolicy) Module {
+	if r, ok := m.(restartModule); ok {
+		m = r.Module
+	}
+	return restartModule{m, policy}
+}
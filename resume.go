@@ -0,0 +1,46 @@
+package barlib
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pgaskin/barlib/dbusutil"
+)
+
+// watchResume calls fn when logind reports that the system resumed from sleep
+// until ctx is cancelled. If the system bus or logind isn't available, it
+// returns immediately, and resumes are only detected as clock jumps while
+// ticking.
+func watchResume(ctx context.Context, logger *slog.Logger, fn func()) {
+	bus, err := dbusutil.SystemBus()
+	if err != nil {
+		logger.Debug("not watching for resumes", "component", "resume", "error", err)
+		return
+	}
+	defer bus.Release()
+
+	sub, err := bus.Subscribe(dbusutil.Match{
+		Sender:    "org.freedesktop.login1",
+		Path:      "/org/freedesktop/login1",
+		Interface: "org.freedesktop.login1.Manager",
+		Member:    "PrepareForSleep",
+	})
+	if err != nil {
+		logger.Debug("not watching for resumes", "component", "resume", "error", err)
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case sig := <-sub.C:
+			if len(sig.Body) == 1 {
+				if start, ok := sig.Body[0].(bool); ok && !start {
+					fn()
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
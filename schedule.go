@@ -0,0 +1,202 @@
+package barlib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when scheduled ticks fire.
+type Schedule interface {
+	// Next returns the next time after t, or the zero time if there are no
+	// more.
+	Next(t time.Time) time.Time
+}
+
+// ScheduleFunc is a [Schedule] implemented as a function.
+type ScheduleFunc func(t time.Time) time.Time
+
+func (fn ScheduleFunc) Next(t time.Time) time.Time {
+	return fn(t)
+}
+
+// Aligned returns a schedule which fires on multiples of interval since the
+// zero time (i.e., at the start of every second, minute, or hour in UTC). If
+// interval is not positive, it never fires.
+//
+// Since the boundaries are in UTC, intervals of an hour or longer will not
+// line up with the local hour in time zones with fractional offsets (e.g.,
+// UTC+5:30), and intervals of a day will not line up with local midnight. For
+// boundaries in the local time zone, use [ParseCron].
+func Aligned(interval time.Duration) Schedule {
+	if interval <= 0 {
+		return ScheduleFunc(func(t time.Time) time.Time {
+			return time.Time{}
+		})
+	}
+	return ScheduleFunc(func(t time.Time) time.Time {
+		return t.Truncate(interval).Add(interval)
+	})
+}
+
+// cronSchedule is a parsed cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bitsets
+	domStar, dowStar              bool
+}
+
+// ParseCron parses a standard five-field cron expression (minute, hour, day of
+// month, month, day of week) evaluated in the local time zone. Fields support
+// "*", numbers, ranges ("1-5"), steps ("*/15", "0-30/10"), and lists ("1,15").
+// The day of week can be 0-7, where both 0 and 7 are Sunday. Like cron, if both
+// the day of month and day of week are restricted, either can match. Names and
+// shortcuts like "@hourly" are not supported.
+func ParseCron(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("parse cron %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var (
+		c   cronSchedule
+		err error
+	)
+	for i, f := range []struct {
+		name     string
+		set      *uint64
+		min, max int
+	}{
+		{"minute", &c.minute, 0, 59},
+		{"hour", &c.hour, 0, 23},
+		{"day of month", &c.dom, 1, 31},
+		{"month", &c.month, 1, 12},
+		{"day of week", &c.dow, 0, 7},
+	} {
+		if *f.set, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("parse cron %q: %s: %w", spec, f.name, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 << 0
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return c, nil
+}
+
+func parseCronField(s string, min, max int) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(s, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+			if hi = lo; isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("range %q out of bounds %d-%d", rng, min, max)
+		}
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+		for v := lo; v <= hi; v += n {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (c cronSchedule) Next(t time.Time) time.Time {
+	t = t.Local()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, time.Local)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		if c.month&(1<<t.Month()) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.Local)
+			continue
+		}
+		if !c.day(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.Local)
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.Local)
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c cronSchedule) day(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// schedule sends ticks on ch for the schedule starting at t until ctx is
+// cancelled. Like regular ticks, they are suspended while the
+// instance is stopped, with a single tick being sent on continue if any were
+// missed.
+func (i *instanceImpl) schedule(ctx context.Context, ch chan<- time.Time, t time.Time, s Schedule) {
+	for !t.IsZero() {
+		wake := i.waker()
+		stopped := i.IsStopped()
+		if now := time.Now(); !stopped && !now.Before(t) {
+			select {
+			case ch <- t:
+			default:
+				// tick missed
+			}
+			if s == nil {
+				return
+			}
+			t = s.Next(now)
+			continue
+		}
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if !stopped {
+			timer = time.NewTimer(time.Until(t))
+			timerC = timer.C
+		}
+		select {
+		case <-timerC:
+		case <-wake:
+			// the clock may have jumped backwards
+			if s != nil {
+				if n := s.Next(time.Now()); !n.IsZero() && n.Before(t) {
+					t = n
+				}
+			}
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package barlib
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	loc := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = loc }()
+
+	date := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.DateTime, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		Spec string
+		From string
+		Next string
+	}{
+		{"* * * * *", "2024-01-01 00:00:30", "2024-01-01 00:01:00"},
+		{"*/15 * * * *", "2024-01-01 00:15:00", "2024-01-01 00:30:00"},
+		{"0 9-17/4 * * *", "2024-01-01 13:00:00", "2024-01-01 17:00:00"},
+		{"0 0 1 * *", "2024-01-15 00:00:00", "2024-02-01 00:00:00"},
+		{"30 8 * * 1-5", "2024-01-05 09:00:00", "2024-01-08 08:30:00"}, // fri -> mon
+		{"0 0 * * 7", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},    // sunday
+		{"0 0 13 * 5", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},   // fri or 13th
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 31 2 *", "2024-01-01 00:00:00", ""},
+	} {
+		s, err := ParseCron(tc.Spec)
+		if err != nil {
+			t.Errorf("parse %q: %v", tc.Spec, err)
+			continue
+		}
+		var exp time.Time
+		if tc.Next != "" {
+			exp = date(tc.Next)
+		}
+		if act := s.Next(date(tc.From)); !act.Equal(exp) {
+			t.Errorf("%q after %s: expected %s, got %s", tc.Spec, tc.From, exp, act)
+		}
+	}
+	for _, spec := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("parse %q: expected error", spec)
+		}
+	}
+}
+
+func TestAligned(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 20, 30, 500, time.UTC)
+	if act, exp := Aligned(time.Minute).Next(from), time.Date(2024, 1, 1, 10, 21, 0, 0, time.UTC); !act.Equal(exp) {
+		t.Errorf("expected %s, got %s", exp, act)
+	}
+	if act, exp := Aligned(time.Second).Next(from), time.Date(2024, 1, 1, 10, 20, 31, 0, time.UTC); !act.Equal(exp) {
+		t.Errorf("expected %s, got %s", exp, act)
+	}
+	if act := Aligned(0).Next(from); !act.IsZero() {
+		t.Errorf("expected zero interval to never fire, got %s", act)
+	}
+}
+
+func TestTickAligned(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tickCh := make(chan time.Time)
+	go Run(ctx, Options{
+		Stdout:   io.Discard,
+		TickRate: time.Second,
+	}, ModuleFunc(func(i Instance) error {
+		at := i.At(time.Now().Add(-time.Hour))
+		for ticker := i.TickAligned(time.Millisecond * 10); ; {
+			select {
+			case tick := <-at:
+				tickCh <- tick
+			case tick := <-ticker:
+				tickCh <- tick
+			case <-i.Context().Done():
+				return nil
+			}
+		}
+	}))
+
+	var aligned int
+	for range 3 {
+		select {
+		case tick := <-tickCh:
+			if tick.Sub(tick.Truncate(time.Millisecond*10)) == 0 {
+				aligned++
+			} else if !tick.Before(time.Now().Add(-time.Minute)) {
+				t.Errorf("unexpected tick %s", tick)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for tick")
+		}
+	}
+	if aligned < 2 {
+		t.Errorf("expected at least 2 aligned ticks, got %d", aligned)
+	}
+}
@@ -0,0 +1,291 @@
+package barlib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// ScriptUrgent is the exit code for a script to mark the block as urgent.
+const ScriptUrgent = 33
+
+// scriptTimeout is the default Script.Timeout.
+const scriptTimeout = time.Second * 30
+
+// Script is a module which runs an i3blocks-compatible script with sh -c.
+//
+// By default, the script is run once, then again on every tick of Interval,
+// on SIGRTMIN+Signal, and when clicked. The output is either the classic
+// format (the full text, short text, and color on separate lines), or a JSON
+// block if JSON is set. If the full text is empty, the block is hidden. If the
+// script exits with ScriptUrgent, the block is marked as urgent, and if it
+// exits with any other non-zero status, an error is shown. If it runs for longer
+// than Timeout, it is killed and an error is shown.
+//
+// If Persist is set, the script is run once and kept running, with every line
+// it writes replacing the block (only the full text for the classic format).
+// Click events are written to stdin as JSON instead.
+//
+// Like i3blocks, the BLOCK_NAME, BLOCK_INSTANCE, and BLOCK_INTERVAL
+// environment variables are set, and when run for a click, BLOCK_BUTTON,
+// BLOCK_MODIFIERS (comma-separated), BLOCK_X, BLOCK_Y, BLOCK_RELATIVE_X,
+// BLOCK_RELATIVE_Y, BLOCK_WIDTH, and BLOCK_HEIGHT are set too.
+type Script struct {
+	Command  string        // shell command
+	Name     string        // for BLOCK_NAME
+	Instance string        // for BLOCK_INSTANCE, and the default block instance
+	Label    string        // prepended to the full text
+	Interval time.Duration // if zero, only run on signals and clicks
+	Timeout  time.Duration // for each run, ignored if Persist (default: 30s)
+	Signal   int           // if non-zero, run on SIGRTMIN+Signal
+	Persist  bool          // keep the script running
+	JSON     bool          // parse the output as JSON blocks
+	Dir      string        // working directory (default: current)
+	Env      []string      // additional environment variables
+}
+
+func (c Script) Run(i Instance) error {
+	if c.Command == "" {
+		return fmt.Errorf("no command specified")
+	}
+	if c.Persist {
+		return c.runPersist(i)
+	}
+	var (
+		signal <-chan struct{}
+		event  *barproto.Event
+		now    bool
+	)
+	if c.Signal != 0 {
+		signal = i.Signal(c.Signal)
+	}
+	for ticker := i.Tick(c.Interval); ; {
+		block, err := c.exec(i, event)
+	render:
+		i.Update(now, func(render Renderer) {
+			if err != nil {
+				i.Theme().Err(render, err)
+				return
+			}
+			if block.FullText != "" {
+				render(block)
+			}
+		})
+		for event, now = nil, false; ; {
+			select {
+			case <-ticker:
+			case <-signal:
+				now = true
+			case ev := <-i.Event():
+				if ev.Release {
+					continue
+				}
+				event, now = &ev, true
+			case <-i.CapabilitiesChanged():
+				goto render // re-render without running the script
+			case <-i.Context().Done():
+				return i.Context().Err()
+			}
+			break
+		}
+	}
+}
+
+// exec runs the script once, optionally for a click event.
+func (c Script) exec(i Instance, event *barproto.Event) (barproto.Block, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = scriptTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(i.Context(), timeout)
+	defer cancel()
+
+	cmd := c.command(ctx, i, event)
+	buf, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded && i.Context().Err() == nil {
+		return barproto.Block{}, fmt.Errorf("timed out after %s", timeout)
+	}
+	var urgent bool
+	if xerr := (*exec.ExitError)(nil); errors.As(err, &xerr) && xerr.ExitCode() == ScriptUrgent {
+		urgent, err = true, nil
+	}
+	if err != nil {
+		return barproto.Block{}, err
+	}
+	block, err := c.parse(buf, false)
+	if err != nil {
+		return barproto.Block{}, err
+	}
+	block.Urgent = block.Urgent || urgent
+	return block, nil
+}
+
+func (c Script) runPersist(i Instance) error {
+	ctx, cancel := context.WithCancel(i.Context())
+	defer cancel()
+
+	cmd := c.command(ctx, i, nil)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		if cmd.ProcessState == nil {
+			cancel()
+			cmd.Wait()
+		}
+	}()
+
+	var (
+		lines   = make(chan []byte, 1)
+		readErr = make(chan error, 1)
+	)
+	go func() {
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			select {
+			case <-lines: // replace the previous one if it hasn't been rendered yet
+			default:
+			}
+			lines <- bytes.Clone(sc.Bytes())
+		}
+		readErr <- sc.Err()
+	}()
+
+	var event []byte
+	for {
+		select {
+		case line := <-lines:
+			block, err := c.parse(line, true)
+			i.Update(false, func(render Renderer) {
+				if err != nil {
+					i.Theme().Err(render, err)
+					return
+				}
+				if block.FullText != "" {
+					render(block)
+				}
+			})
+		case err := <-readErr:
+			if err != nil {
+				cancel() // it might still be running
+				cmd.Wait()
+				return err
+			}
+			killed, err := waitClosed(cmd, cancel)
+			if killed {
+				return fmt.Errorf("command closed stdout")
+			}
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("command exited")
+		case ev := <-i.Event():
+			if ev.Release {
+				continue
+			}
+			ev.Name = c.Name
+			event = ev.AppendJSON(event[:0])
+			event = append(event, '\n')
+			if _, err := stdin.Write(event); err != nil {
+				return fmt.Errorf("write event: %w", err)
+			}
+		case <-i.Context().Done():
+			return i.Context().Err()
+		}
+	}
+}
+
+// parse parses the script output. If line is true, only the full text is
+// read from the classic format.
+func (c Script) parse(buf []byte, line bool) (barproto.Block, error) {
+	var block barproto.Block
+	if c.JSON {
+		if len(bytes.TrimSpace(buf)) == 0 {
+			return block, nil
+		}
+		if err := block.UnmarshalJSON(buf); err != nil {
+			return block, err
+		}
+	} else {
+		lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+		if line {
+			lines = lines[:1]
+		}
+		block.Separator = true
+		block.FullText = lines[0]
+		if len(lines) > 1 {
+			block.ShortText = lines[1]
+		}
+		if len(lines) > 2 && lines[2] != "" {
+			color, err := barproto.ParseColor(lines[2])
+			if err != nil {
+				return block, err
+			}
+			block.Color = color
+		}
+	}
+	if block.FullText != "" {
+		block.FullText = c.Label + block.FullText
+	}
+	if block.Instance == "" {
+		block.Instance = c.Instance
+	}
+	return block, nil
+}
+
+// command creates the command for the script, which is run in a new process
+// group so the entire group is killed when ctx is cancelled.
+func (c Script) command(ctx context.Context, i Instance, event *barproto.Event) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Dir = c.Dir
+	cmd.Env = c.env(event)
+	cmd.Stderr = &execStderr{logger: i.Logger()}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second * 2
+	return cmd
+}
+
+// env returns the environment for the script.
+func (c Script) env(event *barproto.Event) []string {
+	env := append(os.Environ(), c.Env...)
+	env = append(env,
+		"BLOCK_NAME="+c.Name,
+		"BLOCK_INSTANCE="+c.Instance,
+		"BLOCK_INTERVAL="+strconv.Itoa(int(c.Interval/time.Second)),
+	)
+	if event != nil {
+		env = append(env,
+			"BLOCK_BUTTON="+strconv.Itoa(event.Button),
+			"BLOCK_MODIFIERS="+strings.Join(event.ModifierNames(), ","),
+			"BLOCK_X="+strconv.Itoa(event.X),
+			"BLOCK_Y="+strconv.Itoa(event.Y),
+			"BLOCK_RELATIVE_X="+strconv.Itoa(event.RelativeX),
+			"BLOCK_RELATIVE_Y="+strconv.Itoa(event.RelativeY),
+			"BLOCK_WIDTH="+strconv.Itoa(event.Width),
+			"BLOCK_HEIGHT="+strconv.Itoa(event.Height),
+		)
+	}
+	return env
+}
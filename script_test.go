@@ -0,0 +1,190 @@
+package barlib_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/pgaskin/barlib"
+	"github.com/pgaskin/barlib/barlibtest"
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestScript(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Script{
+		Command: `
+			n=$(cat count 2>/dev/null || echo 0)
+			echo $((n+1)) > count
+			if [ -n "$BLOCK_BUTTON" ]; then
+				echo "$BLOCK_NAME $BLOCK_INSTANCE $BLOCK_BUTTON $BLOCK_MODIFIERS $BLOCK_X,$BLOCK_Y"
+				exit 33
+			fi
+			echo "run $((n+1)) $BLOCK_INTERVAL"
+			echo short
+			echo '#FF0000'
+		`,
+		Name:     "test",
+		Instance: "inst",
+		Label:    "> ",
+		Interval: time.Second * 5,
+		Signal:   1,
+		Dir:      t.TempDir(),
+	})
+
+	i.Wait()
+	i.AssertBlocks(barproto.Block{
+		Instance:  "inst",
+		FullText:  "> run 1 5",
+		ShortText: "short",
+		Color:     0xFF0000FF,
+		Separator: true,
+	})
+
+	i.Advance(time.Second * 5)
+	i.Wait()
+	i.AssertText("> run 2 5")
+
+	i.Raise(1)
+	if u := i.Wait(); !u.Now {
+		t.Errorf("expected signal update to be immediate")
+	}
+	i.AssertText("> run 3 5")
+
+	i.Send(barproto.Event{Instance: "inst", Button: 3, Modifiers: xproto.ModMaskShift | xproto.ModMask4, X: 10, Y: 20})
+	i.Wait()
+	i.AssertBlocks(barproto.Block{
+		Instance:  "inst",
+		FullText:  "> test inst 3 Shift,Mod4 10,20",
+		Separator: true,
+		Urgent:    true,
+	})
+}
+
+func TestScriptOutput(t *testing.T) {
+	for _, x := range []struct {
+		Name   string
+		Script barlib.Script
+		Blocks []barproto.Block
+		Error  string
+	}{
+		{"Empty", barlib.Script{Command: `true`}, nil, ""},
+		{"FullText", barlib.Script{Command: `echo a`}, []barproto.Block{{FullText: "a", Separator: true}}, ""},
+		{"Urgent", barlib.Script{Command: `echo a; exit 33`}, []barproto.Block{{FullText: "a", Separator: true, Urgent: true}}, ""},
+		{"Error", barlib.Script{Command: `echo a; exit 1`}, nil, "exit status 1"},
+		{"Color", barlib.Script{Command: `printf 'a\n\nred\n'`}, nil, "invalid color"},
+		{"JSON", barlib.Script{Command: `echo '{"full_text":"a","color":"#00FF00","separator":false}'`, JSON: true, Instance: "x"}, []barproto.Block{{FullText: "a", Instance: "x", Color: 0x00FF00FF, SeparatorBlockWidth: -1}}, ""},
+		{"JSONEmpty", barlib.Script{Command: `true`, JSON: true}, nil, ""},
+		{"Timeout", barlib.Script{Command: `sleep 10`, Timeout: time.Millisecond * 100}, nil, "timed out after 100ms"},
+		{"JSONInvalid", barlib.Script{Command: `echo '{"full_text":1}'`, JSON: true}, nil, "full_text"},
+	} {
+		t.Run(x.Name, func(t *testing.T) {
+			i := barlibtest.New(t, time.Second)
+			i.Run(x.Script)
+			u := i.Wait()
+			if x.Error != "" {
+				if len(u.Blocks) != 1 || !strings.Contains(u.Blocks[0].FullText, x.Error) {
+					t.Errorf("expected error containing %q, got %q", x.Error, u.Text())
+				}
+				return
+			}
+			i.AssertBlocks(x.Blocks...)
+		})
+	}
+}
+
+func TestScriptPersist(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Script{
+		Command: `
+			echo start
+			while read -r event; do
+				case "$event" in
+				'{"name":"test","instance":"inst","button":1,'*) echo click ;;
+				*) echo "bad event" ;;
+				esac
+			done
+		`,
+		Name:     "test",
+		Instance: "inst",
+		Persist:  true,
+	})
+	i.Wait()
+	i.AssertBlocks(barproto.Block{FullText: "start", Instance: "inst", Separator: true})
+
+	i.Click("inst", 1)
+	if u := i.Wait(); !reflect.DeepEqual(u.Text(), []string{"click"}) {
+		t.Errorf("expected click, got %q", u.Text())
+	}
+}
+
+func TestScriptPersistTooLong(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Script{
+		Command: `
+			echo start
+			head -c 100000 /dev/zero | tr '\0' a
+			echo
+			sleep 60
+		`,
+		Persist: true,
+	})
+	i.Wait()
+	i.AssertText("start")
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("expected line too long error, got %v", err)
+	}
+}
+
+func TestScriptPersistCloseStdout(t *testing.T) {
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Script{
+		Command: `
+			echo start
+			exec >&-
+			sleep 100
+		`,
+		Persist: true,
+	})
+	i.Wait()
+	i.AssertText("start")
+	if err := i.WaitErr(); err == nil || !strings.Contains(err.Error(), "closed stdout") {
+		t.Errorf("expected closed stdout error, got %v", err)
+	}
+}
+
+func TestScriptCapabilities(t *testing.T) {
+	dir := t.TempDir()
+	i := barlibtest.New(t, time.Second)
+	i.Run(barlib.Script{
+		Command: `echo x >> runs; exit 1`,
+		Dir:     dir,
+	})
+
+	i.Wait()
+	if b := i.Last().Blocks; len(b) != 1 || b[0].Background != barlib.I3Theme.Urgent {
+		t.Errorf("expected error with block colors on an unknown bar, got %+v", b)
+	}
+
+	i.SetCapabilities(barproto.Capabilities{})
+	i.Wait()
+	if b := i.Last().Blocks; len(b) != 1 || b[0].Background != 0 || b[0].Color != barlib.I3Theme.Urgent {
+		t.Errorf("expected error without block colors, got %+v", b)
+	}
+
+	i.SetCapabilities(barproto.I3bar.Capabilities())
+	i.Wait()
+	if b := i.Last().Blocks; len(b) != 1 || b[0].Background != barlib.I3Theme.Urgent || b[0].Color != 0 {
+		t.Errorf("expected error with block colors, got %+v", b)
+	}
+
+	if buf, err := os.ReadFile(filepath.Join(dir, "runs")); err != nil {
+		t.Errorf("read runs: %v", err)
+	} else if n := strings.Count(string(buf), "x"); n != 1 {
+		t.Errorf("expected script to run once, ran %d times", n)
+	}
+}
@@ -0,0 +1,94 @@
+package barlib
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// sigRTMin is SIGRTMIN as seen by C programs like pkill and i3blocks built
+// against glibc, which reserves the first two real-time signals for threading
+// (the kernel's is 32). Note that musl reserves three, so its SIGRTMIN is 35,
+// and signals sent by musl programs will be off by one.
+const sigRTMin, sigRTMax = 34, 64
+
+func rtSignal(n int) syscall.Signal {
+	if n < 0 || n > sigRTMax-sigRTMin {
+		panic(fmt.Errorf("real-time signal SIGRTMIN+%d out of range", n))
+	}
+	return syscall.Signal(sigRTMin + n)
+}
+
+// signalNotifier handles signals and dispatches them to subscribers.
+type signalNotifier struct {
+	c chan os.Signal                             // incoming signals
+	s map[os.Signal]map[chan<- struct{}]struct{} // subscribers
+	m sync.Mutex                                 // lock for subscriber map
+}
+
+func newSignalNotifier() *signalNotifier {
+	return &signalNotifier{
+		c: make(chan os.Signal, 8),
+		s: make(map[os.Signal]map[chan<- struct{}]struct{}),
+	}
+}
+
+// C returns the channel which must be read from, passing signals not handled
+// directly by the caller to Dispatch.
+func (n *signalNotifier) C() <-chan os.Signal {
+	return n.c
+}
+
+// Handle starts handling sig.
+func (n *signalNotifier) Handle(sig os.Signal) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	if n.s != nil {
+		signal.Notify(n.c, sig)
+	}
+}
+
+// Notify subscribes to sig until cancel is closed.
+func (n *signalNotifier) Notify(cancel <-chan struct{}, sig os.Signal) <-chan struct{} {
+	s := make(chan struct{}, 1)
+	n.m.Lock()
+	if n.s != nil {
+		if n.s[sig] == nil {
+			n.s[sig] = make(map[chan<- struct{}]struct{})
+			signal.Notify(n.c, sig)
+		}
+		n.s[sig][s] = struct{}{}
+		if cancel != nil {
+			go func() {
+				<-cancel
+				n.m.Lock()
+				delete(n.s[sig], s)
+				n.m.Unlock()
+			}()
+		}
+	}
+	n.m.Unlock()
+	return s
+}
+
+// Dispatch notifies subscribers of sig.
+func (n *signalNotifier) Dispatch(sig os.Signal) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	for s := range n.s[sig] {
+		select {
+		case s <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stop stops handling signals.
+func (n *signalNotifier) Stop() {
+	n.m.Lock()
+	defer n.m.Unlock()
+	signal.Stop(n.c)
+	n.s = nil
+}
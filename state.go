@@ -0,0 +1,187 @@
+package barlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State is a key/value store for module state, which is kept across module
+// restarts and hot restarts of the bar, and is optionally persisted to disk
+// (see [Options.StateFile]). Values are encoded as JSON. The zero value is an
+// empty in-memory store.
+type State struct {
+	mu      sync.Mutex
+	m       map[string]json.RawMessage
+	changed func()
+}
+
+// Get decodes the value for key into v, returning false if it is not set or
+// cannot be decoded.
+func (s *State) Get(key string, v any) bool {
+	s.mu.Lock()
+	buf, ok := s.m[key]
+	s.mu.Unlock()
+	return ok && json.Unmarshal(buf, v) == nil
+}
+
+// Set sets the value for key.
+func (s *State) Set(key string, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode state %q: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.m[key]; ok && bytes.Equal(old, buf) {
+		return nil
+	}
+	if s.m == nil {
+		s.m = make(map[string]json.RawMessage)
+	}
+	s.m[key] = buf
+	if s.changed != nil {
+		s.changed()
+	}
+	return nil
+}
+
+// Delete removes the value for key.
+func (s *State) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[key]; ok {
+		delete(s.m, key)
+		if s.changed != nil {
+			s.changed()
+		}
+	}
+}
+
+// DefaultStateFile returns the default state file path for the current
+// executable in $XDG_STATE_HOME. Since the file is overwritten with the state
+// of the entire bar, each bar which may run at the same time (e.g., in daemon
+// mode, or for multiple outputs) must use a different name. If name is empty,
+// the file is named after the executable only.
+func DefaultStateFile(name string) string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if name != "" {
+		name = "." + name
+	}
+	return filepath.Join(dir, "barlib", filepath.Base(exe)+name+".json")
+}
+
+// stateStore contains the state for all instances.
+type stateStore struct {
+	mu      sync.Mutex
+	m       map[string]*State // by instance name and type
+	changed func()
+}
+
+func newStateStore(changed func()) *stateStore {
+	return &stateStore{
+		m:       make(map[string]*State),
+		changed: changed,
+	}
+}
+
+// State gets the state for an instance.
+func (s *stateStore) State(name, typ string) *State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := name + " " + typ
+	if s.m[key] == nil {
+		s.m[key] = &State{changed: s.changed}
+	}
+	return s.m[key]
+}
+
+// Load merges the state from the file at path. If the file does not exist, nil
+// is returned.
+func (s *stateStore) Load(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var m map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, values := range m {
+		if s.m[key] == nil {
+			s.m[key] = &State{changed: s.changed}
+		}
+		st := s.m[key]
+		st.mu.Lock()
+		if st.m == nil {
+			st.m = make(map[string]json.RawMessage, len(values))
+		}
+		maps.Copy(st.m, values)
+		st.mu.Unlock()
+	}
+	return nil
+}
+
+// Save atomically writes the state to the file at path.
+func (s *stateStore) Save(path string) error {
+	m := make(map[string]map[string]json.RawMessage)
+	s.mu.Lock()
+	for key, st := range s.m {
+		st.mu.Lock()
+		if len(st.m) != 0 {
+			m[key] = maps.Clone(st.m)
+		}
+		st.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// create a new file (with O_EXCL and mode 0600) so an existing one
+	// (possibly created by someone else) is never written to
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
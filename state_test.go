@@ -0,0 +1,71 @@
+package barlib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	var changed int
+	s1 := newStateStore(func() { changed++ })
+
+	st := s1.State("0", "main.Test")
+	if st.Set("a", 1); changed != 1 {
+		t.Errorf("expected change")
+	}
+	if st.Set("a", 1); changed != 1 {
+		t.Errorf("expected no change for the same value")
+	}
+	st.Set("b", []string{"x"})
+	st.Delete("b")
+	s1.State("1", "main.Test").Set("c", "y")
+
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	if err := s1.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	s2 := newStateStore(nil)
+	if err := s2.Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var a int
+	if !s2.State("0", "main.Test").Get("a", &a) || a != 1 {
+		t.Errorf("expected a=1, got %d", a)
+	}
+	var b []string
+	if s2.State("0", "main.Test").Get("b", &b) {
+		t.Errorf("expected b to be deleted")
+	}
+	var c string
+	if s2.State("1", "main.Other").Get("c", &c) {
+		t.Errorf("expected state to be matched by type")
+	}
+	if !s2.State("1", "main.Test").Get("c", &c) || c != "y" {
+		t.Errorf("expected c=y, got %q", c)
+	}
+	if s2.State("1", "main.Test").Get("c", &a) {
+		t.Errorf("expected decode error to return false")
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Errorf("stat: %v", err)
+	} else if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected state file mode 0600, got %s", perm)
+	}
+
+	target := filepath.Join(t.TempDir(), "target")
+	os.WriteFile(target, nil, 0o644)
+	os.Remove(path)
+	os.Symlink(target, path)
+	if err := s1.Save(path); err != nil {
+		t.Errorf("save over symlink: %v", err)
+	} else if buf, _ := os.ReadFile(target); len(buf) != 0 {
+		t.Errorf("expected symlink target to be left alone")
+	}
+
+	if err := newStateStore(nil).Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("expected missing state file to be ignored, got %v", err)
+	}
+}
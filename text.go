@@ -0,0 +1,230 @@
+package barlib
+
+import (
+	"iter"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ellipsis is appended to truncated text.
+const Ellipsis = "…"
+
+// RuneWidth returns the approximate display width of r in cells. Combining
+// marks and format characters have a width of zero, and East Asian wide
+// characters, emoji, and private-use glyphs (e.g., Font Awesome icons) have a
+// width of two.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0, r < 0x20, r >= 0x7F && r < 0xA0:
+		return 0
+	case r < 0x300:
+		return 1
+	case r == 0x200D, r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF:
+		return 0 // zwj, variation selectors
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	for _, x := range wideRunes {
+		if r < x[0] {
+			break
+		}
+		if r <= x[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// Width returns the approximate display width of s in cells (see
+// [RuneWidth]).
+func Width(s string) int {
+	var n int
+	for _, r := range s {
+		n += RuneWidth(r)
+	}
+	return n
+}
+
+// Truncate truncates s to at most width cells, replacing the end with
+// [Ellipsis] if it was truncated.
+func Truncate(s string, width int) string {
+	if Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	var (
+		n   int
+		end int
+	)
+	for i, r := range s {
+		w := RuneWidth(r)
+		if w != 0 && n+w > width-1 {
+			break
+		}
+		n += w
+		end = i + utf8.RuneLen(r)
+	}
+	return strings.TrimRightFunc(s[:end], unicode.IsSpace) + Ellipsis
+}
+
+// Marquee scrolls text which is wider than a fixed width. The position is
+// advanced by calling Step, typically on a ticker which is only enabled while
+// Scrolling is true (since [Instance.Tick] is suspended while the bar is
+// stopped, the text will only scroll while the bar is visible).
+type Marquee struct {
+	Width int    // cells
+	Gap   string // between repetitions of the text (default: three spaces)
+
+	text  string
+	cells []string // grapheme-ish clusters of text+gap
+	offs  []int    // byte offsets of cells in text (-1 for the gap)
+	pos   int
+}
+
+// Set sets the text, resetting the position if it changed, and returns whether
+// it needs to scroll.
+func (m *Marquee) Set(s string) bool {
+	if s != m.text || m.cells == nil {
+		m.text, m.pos, m.cells, m.offs = s, 0, m.cells[:0], m.offs[:0]
+		if Width(s) > m.Width {
+			gap := m.Gap
+			if gap == "" {
+				gap = "   "
+			}
+			for i, r := range s + gap {
+				if RuneWidth(r) == 0 && len(m.cells) != 0 {
+					m.cells[len(m.cells)-1] += string(r)
+				} else {
+					m.cells = append(m.cells, (s + gap)[i:i+utf8.RuneLen(r)])
+					if i < len(s) {
+						m.offs = append(m.offs, i)
+					} else {
+						m.offs = append(m.offs, -1)
+					}
+				}
+			}
+		}
+	}
+	return m.Scrolling()
+}
+
+// Scrolling returns true if the text is wider than the width.
+func (m *Marquee) Scrolling() bool {
+	return len(m.cells) != 0
+}
+
+// Step advances the position by one character.
+func (m *Marquee) Step() {
+	if len(m.cells) != 0 {
+		m.pos = (m.pos + 1) % len(m.cells)
+	}
+}
+
+// String returns the visible text. If the text is scrolling, it is padded to
+// exactly Width cells.
+func (m *Marquee) String() string {
+	if len(m.cells) == 0 {
+		return m.text
+	}
+	var b strings.Builder
+	for _, c := range m.Cells() {
+		b.WriteString(c)
+	}
+	return b.String()
+}
+
+// Cells returns the visible characters (see String) with their byte offset in
+// the text, which can be used to style parts of the text differently. The gap
+// and padding have an offset of -1. If the text isn't scrolling, it is returned
+// as a single string with an offset of zero.
+func (m *Marquee) Cells() iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		if len(m.cells) == 0 {
+			yield(0, m.text)
+			return
+		}
+		for i, n := 0, 0; n < m.Width; i++ {
+			j := (m.pos + i) % len(m.cells)
+			w := Width(m.cells[j])
+			if n+w > m.Width {
+				yield(-1, strings.Repeat(" ", m.Width-n))
+				return
+			}
+			if !yield(m.offs[j], m.cells[j]) {
+				return
+			}
+			n += w
+		}
+	}
+}
+
+// wideRunes contains sorted inclusive ranges of East Asian wide and fullwidth
+// characters, emoji, and private-use characters.
+var wideRunes = [][2]rune{
+	{0x1100, 0x115F},    // hangul jamo
+	{0x231A, 0x231B},    // watch, hourglass
+	{0x2329, 0x232A},    // angle brackets
+	{0x23E9, 0x23EC},    // media controls
+	{0x23F0, 0x23F0},    // alarm clock
+	{0x23F3, 0x23F3},    // hourglass
+	{0x25FD, 0x25FE},    // squares
+	{0x2614, 0x2615},    // umbrella, hot beverage
+	{0x2648, 0x2653},    // zodiac
+	{0x267F, 0x267F},    // wheelchair
+	{0x2693, 0x2693},    // anchor
+	{0x26A1, 0x26A1},    // high voltage
+	{0x26AA, 0x26AB},    // circles
+	{0x26BD, 0x26BE},    // balls
+	{0x26C4, 0x26C5},    // snowman, sun
+	{0x26CE, 0x26CE},    // ophiuchus
+	{0x26D4, 0x26D4},    // no entry
+	{0x26EA, 0x26EA},    // church
+	{0x26F2, 0x26F3},    // fountain, golf
+	{0x26F5, 0x26F5},    // sailboat
+	{0x26FA, 0x26FA},    // tent
+	{0x26FD, 0x26FD},    // fuel pump
+	{0x2705, 0x2705},    // check mark
+	{0x270A, 0x270B},    // hands
+	{0x2728, 0x2728},    // sparkles
+	{0x274C, 0x274C},    // cross mark
+	{0x274E, 0x274E},    // cross mark
+	{0x2753, 0x2755},    // question marks
+	{0x2757, 0x2757},    // exclamation mark
+	{0x2795, 0x2797},    // math
+	{0x27B0, 0x27B0},    // curly loop
+	{0x27BF, 0x27BF},    // double curly loop
+	{0x2B1B, 0x2B1C},    // squares
+	{0x2B50, 0x2B50},    // star
+	{0x2B55, 0x2B55},    // circle
+	{0x2E80, 0x303E},    // cjk radicals, symbols, punctuation
+	{0x3041, 0x33FF},    // kana, bopomofo, cjk compatibility
+	{0x3400, 0x4DBF},    // cjk extension a
+	{0x4E00, 0x9FFF},    // cjk unified ideographs
+	{0xA000, 0xA4CF},    // yi
+	{0xA960, 0xA97F},    // hangul jamo extended-a
+	{0xAC00, 0xD7A3},    // hangul syllables
+	{0xE000, 0xF8FF},    // private use (e.g., font awesome)
+	{0xF900, 0xFAFF},    // cjk compatibility ideographs
+	{0xFE10, 0xFE19},    // vertical forms
+	{0xFE30, 0xFE6F},    // cjk compatibility forms, small forms
+	{0xFF00, 0xFF60},    // fullwidth forms
+	{0xFFE0, 0xFFE6},    // fullwidth signs
+	{0x16FE0, 0x18CFF},  // tangut, khitan
+	{0x1B000, 0x1B2FF},  // kana supplement, nushu
+	{0x1F004, 0x1F004},  // mahjong
+	{0x1F0CF, 0x1F0CF},  // joker
+	{0x1F18E, 0x1F18E},  // ab button
+	{0x1F191, 0x1F19A},  // squared words
+	{0x1F200, 0x1F2FF},  // enclosed ideographic supplement
+	{0x1F300, 0x1F64F},  // misc symbols and pictographs, emoticons
+	{0x1F680, 0x1F6FF},  // transport and map
+	{0x1F7E0, 0x1F7EB},  // colored shapes
+	{0x1F90C, 0x1F9FF},  // supplemental symbols and pictographs
+	{0x1FA70, 0x1FAFF},  // symbols and pictographs extended-a
+	{0x20000, 0x2FFFD},  // cjk extensions b-f
+	{0x30000, 0x3FFFD},  // cjk extension g
+	{0xF0000, 0x10FFFD}, // supplementary private use
+}
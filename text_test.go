@@ -0,0 +1,83 @@
+package barlib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	for s, exp := range map[string]int{
+		"":                     0,
+		"abc":                  3,
+		"\u65e5\u672c\u8a9e":   6, // cjk
+		"\ud55c\uad6d\uc5b4":   6, // hangul
+		"\uff46\uff55":         4, // fullwidth
+		"e\u0301":              1, // combining accent
+		"\uf001 x":             4, // font awesome
+		"\U0001F3B5":           2, // emoji
+		"\U0001F44D\U0001F3FD": 4, // skin tone modifier (not combined)
+		"\u2764\ufe0f":         1, // variation selector
+	} {
+		if act := Width(s); act != exp {
+			t.Errorf("Width(%q): expected %d, got %d", s, exp, act)
+		}
+	}
+
+	for _, tc := range []struct {
+		S     string
+		Width int
+		Exp   string
+	}{
+		{"hello world", 20, "hello world"},
+		{"hello world", 11, "hello world"},
+		{"hello world", 10, "hello wor…"},
+		{"hello world", 7, "hello…"},
+		{"hello world", 1, "…"},
+		{"hello world", 0, ""},
+		{"日本語の曲", 6, "日本…"},
+		{"日本語の曲", 5, "日本…"},
+		{"café music", 5, "café…"},
+	} {
+		if act := Truncate(tc.S, tc.Width); act != tc.Exp {
+			t.Errorf("Truncate(%q, %d): expected %q, got %q", tc.S, tc.Width, tc.Exp, act)
+		}
+	}
+
+	m := Marquee{Width: 4, Gap: " "}
+	if m.Set("abc") || m.String() != "abc" {
+		t.Errorf("expected short text to not scroll, got %q", m.String())
+	}
+	if !m.Set("abcdef") {
+		t.Fatalf("expected long text to scroll")
+	}
+	for _, exp := range []string{"abcd", "bcde", "cdef", "def ", "ef a", "f ab", " abc", "abcd"} {
+		if act := m.String(); act != exp {
+			t.Errorf("Marquee: expected %q, got %q", exp, act)
+		}
+		m.Step()
+	}
+	m.Set("abcdef")
+	if act, exp := m.String(), "bcde"; act != exp {
+		t.Errorf("Marquee: expected position to be kept for the same text, got %q", act)
+	}
+	m.Step()
+	m.Step()
+	var offs []int
+	for off := range m.Cells() {
+		offs = append(offs, off)
+	}
+	if exp := []int{3, 4, 5, -1}; !slices.Equal(offs, exp) {
+		t.Errorf("Marquee: expected cell offsets %v, got %v", exp, offs)
+	}
+	m.Set("日本語の曲")
+	m.Step()
+	if act, exp := m.String(), "本語"; act != exp {
+		t.Errorf("Marquee: expected %q, got %q", exp, act)
+	}
+	m.Step()
+	m.Step()
+	m.Step()
+	if act, exp := m.String(), "曲  "; act != exp {
+		t.Errorf("Marquee: expected %q, got %q", exp, act)
+	}
+}
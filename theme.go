@@ -0,0 +1,138 @@
+package barlib
+
+import (
+	"strings"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Theme contains semantic colors and styles shared by all modules. Colors are
+// 0xRRGGBBAA, with 0x00000000 being the bar's default color.
+type Theme struct {
+	Good     uint32 // normal or active state
+	Degraded uint32 // warnings or partially working state
+	Bad      uint32 // errors or critical state
+	Idle     uint32 // inactive, paused, or disabled state
+	Accent   uint32 // informational highlights
+	Boost    uint32 // high-power or performance state
+	Urgent   uint32 // background for urgent blocks like errors
+
+	SeparatorBlockWidth     int // between related blocks within a module
+	IconSeparatorBlockWidth int // between an icon and its label
+
+	// Error is the style of error blocks (the text is replaced). If it is
+	// urgent and doesn't have a background, Urgent is used.
+	Error barproto.Block
+
+	noBlockColors bool // see For
+}
+
+// I3Theme is the default theme, which matches i3status.
+var I3Theme = Theme{
+	Good:                    0x00FF00FF,
+	Degraded:                0xFFFF00FF,
+	Bad:                     0xFF0000FF,
+	Idle:                    0xFFFF00FF, // same as degraded, like i3status
+	Accent:                  0x87CEEBFF,
+	Boost:                   0xFF5C00FF,
+	Urgent:                  0xFF0000FF,
+	SeparatorBlockWidth:     8,
+	IconSeparatorBlockWidth: 5,
+	Error: barproto.Block{
+		Urgent:       true,
+		Separator:    true,
+		BorderTop:    -1,
+		BorderLeft:   -1,
+		BorderBottom: -1,
+		BorderRight:  -1,
+	},
+}
+
+// SolarizedTheme uses the solarized palette.
+var SolarizedTheme = Theme{
+	Good:                    0x859900FF,
+	Degraded:                0xB58900FF,
+	Bad:                     0xDC322FFF,
+	Idle:                    0x586E75FF,
+	Accent:                  0x268BD2FF,
+	Boost:                   0xCB4B16FF,
+	Urgent:                  0xDC322FFF,
+	SeparatorBlockWidth:     8,
+	IconSeparatorBlockWidth: 5,
+	Error: barproto.Block{
+		Urgent:       true,
+		Separator:    true,
+		Color:        0xFDF6E3FF,
+		BorderTop:    -1,
+		BorderLeft:   -1,
+		BorderBottom: -1,
+		BorderRight:  -1,
+	},
+}
+
+// GruvboxTheme uses the dark gruvbox palette.
+var GruvboxTheme = Theme{
+	Good:                    0xB8BB26FF,
+	Degraded:                0xFABD2FFF,
+	Bad:                     0xFB4934FF,
+	Idle:                    0x928374FF,
+	Accent:                  0x83A598FF,
+	Boost:                   0xFE8019FF,
+	Urgent:                  0xCC241DFF,
+	SeparatorBlockWidth:     8,
+	IconSeparatorBlockWidth: 5,
+	Error: barproto.Block{
+		Urgent:       true,
+		Separator:    true,
+		Color:        0xFBF1C7FF,
+		BorderTop:    -1,
+		BorderLeft:   -1,
+		BorderBottom: -1,
+		BorderRight:  -1,
+	},
+}
+
+// ThemeByName returns the built-in theme with the specified name (i3,
+// solarized, or gruvbox).
+func ThemeByName(name string) (Theme, bool) {
+	switch strings.ToLower(name) {
+	case "i3", "default", "":
+		return I3Theme, true
+	case "solarized":
+		return SolarizedTheme, true
+	case "gruvbox":
+		return GruvboxTheme, true
+	}
+	return Theme{}, false
+}
+
+// For returns the theme adjusted for a bar with caps. Without
+// [barproto.Capabilities.BlockColors], error blocks use their background color
+// for the text instead, and don't have borders.
+func (t Theme) For(caps barproto.Capabilities) Theme {
+	t.noBlockColors = !caps.BlockColors
+	return t
+}
+
+// Err renders an error message block with r, styled using the theme.
+func (t Theme) Err(r Renderer, err error) {
+	var s string
+	if err != nil {
+		s = err.Error()
+	} else {
+		s = "<nil>"
+	}
+	b := t.Error
+	if b.Urgent && b.Background == 0 {
+		b.Background = t.Urgent
+	}
+	if t.noBlockColors {
+		if b.Background != 0 {
+			b.Color, b.Background = b.Background, 0
+		}
+		b.Border, b.BorderTop, b.BorderRight, b.BorderBottom, b.BorderLeft = 0, 0, 0, 0, 0
+	}
+	b.FullText = " error: " + s + " "
+	b.ShortText = "ERR"
+	r(b)
+}
@@ -0,0 +1,50 @@
+package barlib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestTheme(t *testing.T) {
+	for _, name := range []string{"i3", "solarized", "Gruvbox"} {
+		if _, ok := ThemeByName(name); !ok {
+			t.Errorf("expected theme %q to exist", name)
+		}
+	}
+	if _, ok := ThemeByName("nonexistent"); ok {
+		t.Errorf("expected unknown theme to not exist")
+	}
+
+	theme := SolarizedTheme
+	theme.IconSeparatorBlockWidth = 3
+
+	var blocks []barproto.Block
+	render := Renderer(func(b barproto.Block) { blocks = append(blocks, b) })
+	theme.Err(render, errors.New("test"))
+	theme.Icon(render, "I", barproto.Block{FullText: "label"})
+	render.Err(errors.New("default"))
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d", len(blocks))
+	}
+	if b := blocks[0]; b.FullText != " error: test " || b.ShortText != "ERR" || b.Name != "" || b.Background != theme.Urgent || b.Color != theme.Error.Color || !b.Urgent {
+		t.Errorf("incorrect error block %+v", b)
+	}
+	if b := blocks[1]; b.Name != "" || b.SeparatorBlockWidth != 3 {
+		t.Errorf("incorrect icon block %+v", b)
+	}
+	if b := blocks[3]; b.FullText != " error: default " || b.Name != "" || b.Background != I3Theme.Urgent || b.Color != I3Theme.Error.Color {
+		t.Errorf("incorrect default error block %+v", b)
+	}
+
+	blocks = blocks[:0]
+	theme.For(barproto.Capabilities{}).Err(render, errors.New("test"))
+	theme.For(barproto.I3bar.Capabilities()).Err(render, errors.New("test"))
+	if b := blocks[0]; b.Color != theme.Urgent || b.Background != 0 || b.BorderTop != 0 {
+		t.Errorf("incorrect error block without block colors %+v", b)
+	}
+	if b := blocks[1]; b.Color != theme.Error.Color || b.Background != theme.Urgent || b.BorderTop != -1 {
+		t.Errorf("incorrect error block with block colors %+v", b)
+	}
+}
@@ -0,0 +1,118 @@
+package barlib
+
+import (
+	"encoding/json"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// WaybarOutput writes lines for a waybar custom module with return-type set to
+// json. Usually, [Options.Select] is used to run a single module per waybar
+// custom module.
+//
+// Waybar does not send click events to stdin. Instead, [Options.ControlSocket]
+// should be set to a fixed path, and the on-click handlers should use
+// barlibctl (e.g., "barlibctl -socket path click PulseAudio 1 snk_vol").
+//
+// The text and tooltip are pango markup. The tooltip contains the full text of
+// each block on a separate line. The percentage is the first number followed by
+// a percent sign in the full text, if any. The classes are "urgent" for urgent
+// blocks, "color-rrggbb" for the text color, and "background-rrggbb" for the
+// background color, without duplicates.
+type WaybarOutput struct {
+	Separator string // between blocks with Separator set (default " | ")
+	Short     bool   // use ShortText if set
+}
+
+func (WaybarOutput) AppendHeader(b []byte, init barproto.Init) []byte {
+	return b
+}
+
+func (o WaybarOutput) AppendStatus(b []byte, blocks []barproto.Block) []byte {
+	var obj struct {
+		Text       string   `json:"text"`
+		Tooltip    string   `json:"tooltip,omitempty"`
+		Class      []string `json:"class,omitempty"`
+		Percentage *int     `json:"percentage,omitempty"`
+	}
+	var tooltip strings.Builder
+	for i, block := range blocks {
+		if obj.Percentage == nil {
+			if v, ok := findPercentage(textOf(block, false)); ok {
+				obj.Percentage = &v
+			}
+		}
+		if i != 0 {
+			tooltip.WriteByte('\n')
+		}
+
+		var class []string
+		if block.Urgent {
+			class = append(class, "urgent")
+		}
+		if v := block.Color; v != 0 {
+			class = append(class, "color-"+string(appendHex(nil, v>>8, 6)))
+		}
+		if v := block.Background; v != 0 {
+			class = append(class, "background-"+string(appendHex(nil, v>>8, 6)))
+		}
+		for _, c := range class {
+			c = strings.ToLower(c)
+			if !slices.Contains(obj.Class, c) {
+				obj.Class = append(obj.Class, c)
+			}
+		}
+
+		tooltip.WriteString(strings.TrimSpace(waybarMarkup(block, false)))
+	}
+	obj.Text = string(appendText(nil, blocks, o.Short, html.EscapeString(o.Separator), waybarMarkup, nil, nil))
+	obj.Tooltip = tooltip.String()
+
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	b = append(b, buf...)
+	b = append(b, '\n')
+	return b
+}
+
+func (WaybarOutput) ParseEvent(line []byte) (barproto.Event, bool, error) {
+	return barproto.Event{}, false, nil
+}
+
+// waybarMarkup gets the text of a block as pango markup.
+func waybarMarkup(block barproto.Block, short bool) string {
+	s := block.FullText
+	if short && block.ShortText != "" {
+		s = block.ShortText
+	}
+	if !block.Pango {
+		s = html.EscapeString(s)
+	}
+	return s
+}
+
+// findPercentage finds the first integer followed by a percent sign in s.
+func findPercentage(s string) (int, bool) {
+	for i := range len(s) {
+		if s[i] != '%' {
+			continue
+		}
+		j := i
+		for j > 0 && s[j-1] >= '0' && s[j-1] <= '9' {
+			j--
+		}
+		if j == i {
+			continue
+		}
+		if n, err := strconv.Atoi(s[j:i]); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,178 @@
+package barlib
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+// Icon renders an icon with r in a separate block before the label block, with
+// the same colors and instance as the label, separated by the theme's
+// IconSeparatorBlockWidth. If icon is empty, only the label is rendered.
+func (t Theme) Icon(r Renderer, icon string, label barproto.Block) {
+	if icon != "" {
+		r(barproto.Block{
+			FullText:            icon,
+			Color:               label.Color,
+			Background:          label.Background,
+			Instance:            label.Instance,
+			Urgent:              label.Urgent,
+			SeparatorBlockWidth: t.IconSeparatorBlockWidth,
+		})
+	}
+	r(label)
+}
+
+// Gauge renders block with r with a progress bar for v (0-1) of width cells
+// appended to the text, colored using th unless the block already has a color.
+// If the block doesn't have a ShortText, it is set to the percentage.
+func (t Theme) Gauge(r Renderer, block barproto.Block, v float64, width int, th Thresholds) {
+	if block.FullText != "" {
+		block.FullText += " "
+	}
+	block.FullText += ProgressBar(v, width)
+	if block.ShortText == "" {
+		block.ShortText = strconv.Itoa(int(math.Round(clamp01(v)*100))) + "%"
+	}
+	if block.Color == 0 {
+		block.Color = th.Color(v)
+	}
+	r(block)
+}
+
+// Sparkline renders block with r with a sparkline of the values in ring (see
+// [Ring.Sparkline]) prepended to the text. If the block doesn't have a
+// ShortText, it is set to the text without the sparkline.
+func (t Theme) Sparkline(r Renderer, block barproto.Block, ring *Ring, lo, hi float64) {
+	if block.ShortText == "" {
+		block.ShortText = block.FullText
+	}
+	if block.FullText != "" {
+		block.FullText = " " + block.FullText
+	}
+	block.FullText = ring.Sparkline(lo, hi) + block.FullText
+	r(block)
+}
+
+// Threshold is a color for values greater than or equal to Value.
+type Threshold struct {
+	Value float64
+	Color uint32 // 0xRRGGBBAA
+}
+
+// Thresholds is a list of thresholds in ascending order.
+type Thresholds []Threshold
+
+// Color gets the color for v, which is the color of the last threshold less
+// than or equal to v, or zero if there is none.
+func (t Thresholds) Color(v float64) uint32 {
+	var c uint32
+	for _, x := range t {
+		if v < x.Value {
+			break
+		}
+		c = x.Color
+	}
+	return c
+}
+
+var (
+	progressRunes  = []rune(" ▏▎▍▌▋▊▉█")
+	sparklineRunes = []rune("▁▂▃▄▅▆▇█")
+)
+
+// ProgressBar returns a progress bar for v (0-1) which is width cells wide,
+// using eighth blocks for partially filled cells.
+func ProgressBar(v float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	n := int(math.Round(clamp01(v) * float64(width) * 8))
+	var b strings.Builder
+	for range width {
+		b.WriteRune(progressRunes[min(max(n, 0), 8)])
+		n -= 8
+	}
+	return b.String()
+}
+
+// Sparkline returns a sparkline for values scaled between lo and hi, with one
+// cell per value. If lo >= hi, the values are scaled between their minimum and
+// maximum. NaN values are rendered as spaces.
+func Sparkline(values []float64, lo, hi float64) string {
+	if lo >= hi {
+		lo, hi = math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			if !math.IsNaN(v) {
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			b.WriteByte(' ')
+		case hi <= lo:
+			b.WriteRune(sparklineRunes[0])
+		default:
+			n := int(math.Round(clamp01((v-lo)/(hi-lo)) * float64(len(sparklineRunes)-1)))
+			b.WriteRune(sparklineRunes[n])
+		}
+	}
+	return b.String()
+}
+
+// Ring is a fixed-size ring buffer of samples (e.g., for sparklines). The zero
+// value is not usable.
+type Ring struct {
+	v []float64
+	n int // number of values
+	i int // next index
+}
+
+// NewRing creates a new ring buffer holding up to size values.
+func NewRing(size int) *Ring {
+	return &Ring{v: make([]float64, max(size, 1))}
+}
+
+// Push adds a value, overwriting the oldest one if full.
+func (r *Ring) Push(v float64) {
+	r.v[r.i] = v
+	r.i = (r.i + 1) % len(r.v)
+	r.n = min(r.n+1, len(r.v))
+}
+
+// Reset removes all values.
+func (r *Ring) Reset() {
+	r.n, r.i = 0, 0
+}
+
+// Len returns the number of values.
+func (r *Ring) Len() int {
+	return r.n
+}
+
+// Values returns the values from oldest to newest.
+func (r *Ring) Values() []float64 {
+	s := make([]float64, 0, r.n)
+	for j := range r.n {
+		s = append(s, r.v[(r.i-r.n+j+len(r.v))%len(r.v)])
+	}
+	return s
+}
+
+// Sparkline returns a sparkline of the values (see [Sparkline]), padded on the
+// left to the size of the buffer.
+func (r *Ring) Sparkline(lo, hi float64) string {
+	return strings.Repeat(" ", len(r.v)-r.n) + Sparkline(r.Values(), lo, hi)
+}
+
+func clamp01(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return min(max(v, 0), 1)
+}
@@ -0,0 +1,73 @@
+package barlib
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/pgaskin/barlib/barproto"
+)
+
+func TestWidgets(t *testing.T) {
+	for _, tc := range []struct {
+		V     float64
+		Width int
+		Exp   string
+	}{
+		{0, 3, "   "},
+		{1, 3, "███"},
+		{0.5, 3, "█▌ "},
+		{0.51, 1, "▌"},
+		{2, 2, "██"},
+		{math.NaN(), 2, "  "},
+		{0.5, 0, ""},
+	} {
+		if act := ProgressBar(tc.V, tc.Width); act != tc.Exp {
+			t.Errorf("ProgressBar(%v, %d): expected %q, got %q", tc.V, tc.Width, tc.Exp, act)
+		}
+	}
+
+	if act, exp := Sparkline([]float64{0, 0.5, 1, math.NaN()}, 0, 1), "▁▅█ "; act != exp {
+		t.Errorf("Sparkline: expected %q, got %q", exp, act)
+	}
+	if act, exp := Sparkline([]float64{10, 20, 30}, 0, 0), "▁▅█"; act != exp {
+		t.Errorf("Sparkline (auto): expected %q, got %q", exp, act)
+	}
+
+	r := NewRing(3)
+	r.Push(1)
+	if act, exp := r.Sparkline(0, 1), "  █"; act != exp {
+		t.Errorf("Ring.Sparkline: expected %q, got %q", exp, act)
+	}
+	for _, v := range []float64{2, 3, 4} {
+		r.Push(v)
+	}
+	if act, exp := r.Values(), []float64{2, 3, 4}; !slices.Equal(act, exp) {
+		t.Errorf("Ring.Values: expected %v, got %v", exp, act)
+	}
+
+	th := Thresholds{{0.5, 0xFFFF00FF}, {0.9, 0xFF0000FF}}
+	for v, exp := range map[float64]uint32{0.1: 0, 0.5: 0xFFFF00FF, 0.95: 0xFF0000FF} {
+		if act := th.Color(v); act != exp {
+			t.Errorf("Thresholds.Color(%v): expected %08X, got %08X", v, exp, act)
+		}
+	}
+
+	var blocks []barproto.Block
+	render := Renderer(func(b barproto.Block) { blocks = append(blocks, b) })
+	I3Theme.Icon(render, "I", barproto.Block{FullText: "label", Instance: "x", Color: 0x00FF00FF, Separator: true})
+	I3Theme.Gauge(render, barproto.Block{FullText: "mem"}, 0.95, 2, th)
+	I3Theme.Sparkline(render, barproto.Block{FullText: "cpu"}, r, 0, 4)
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d", len(blocks))
+	}
+	if b := blocks[0]; b.FullText != "I" || b.Instance != "x" || b.Color != 0x00FF00FF || b.Separator || b.Name != "" || b.SeparatorBlockWidth != I3Theme.IconSeparatorBlockWidth {
+		t.Errorf("incorrect icon block %+v", b)
+	}
+	if b := blocks[2]; b.FullText != "mem █▉" || b.ShortText != "95%" || b.Color != 0xFF0000FF {
+		t.Errorf("incorrect gauge block %+v", b)
+	}
+	if b := blocks[3]; b.FullText != r.Sparkline(0, 4)+" cpu" || b.ShortText != "cpu" {
+		t.Errorf("incorrect sparkline block %+v", b)
+	}
+}